@@ -16,6 +16,7 @@ limitations under the License.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -26,7 +27,9 @@ import (
 	"github.com/loft-orbital/cuebe/internal/utils"
 	"github.com/loft-orbital/cuebe/pkg/build"
 	"github.com/loft-orbital/cuebe/pkg/instance"
+	"github.com/loft-orbital/cuebe/pkg/log"
 	"github.com/loft-orbital/cuebe/pkg/manifest"
+	"github.com/loft-orbital/cuebe/pkg/sensitive"
 	"github.com/spf13/cobra"
 )
 
@@ -48,6 +51,15 @@ grouping them by instance if necessary.
 # Apply current directory with an encrypted file override
 cuebe apply . main.enc.yaml
 
+# Apply a remote cube, pinning its checksum
+cuebe apply https://host/cube.tar.gz#sha256=<hex>
+
+# Apply the deploy/ directory of a git repository at tag v1.2.3
+cuebe apply git+https://github.com/org/repo.git//deploy?ref=v1.2.3
+
+# Mount a shared directory under secrets/ and a single file as overrides/prod.cue
+cuebe apply . ../shared-secrets:secrets/ ./prod.cue:overrides/prod.cue
+
 # Extract Kubernetes context from <Build>.path.to.context
 cuebe apply -c .release.context .
 
@@ -70,7 +82,7 @@ cuebe apply --dry-run .
 }
 
 func runApply(cmd *cobra.Command, args []string) {
-	mfs, build, err := manifetsFrom(cmd)
+	mfs, build, err := manifetsFrom(cmd, nil)
 	cobra.CheckErr(err)
 
 	// group by Instances
@@ -111,16 +123,44 @@ func getK8sConfig(context string) (*utils.K8sConfig, error) {
 }
 
 // TODO move that in its own package
-func manifetsFrom(cmd *cobra.Command) ([]manifest.Manifest, cue.Value, error) {
+// manifetsFrom builds the context and extracts its manifests,
+// collecting the paths of the sensitive values in sens, if set.
+// Once built, sensitive values are redacted from errors and from the command logger.
+func manifetsFrom(cmd *cobra.Command, sens *sensitive.Paths) ([]manifest.Manifest, cue.Value, error) {
 	opts := factory.GetBuildOpt(cmd)
+	if sens == nil {
+		sens = sensitive.NewPaths()
+	}
+
+	// k8s injections read from the target cluster, if any, or the current kube config context
+	cluster := func() (*utils.K8sConfig, error) {
+		kctx := ""
+		if f := cmd.Flags().Lookup("cluster"); f != nil {
+			kctx = f.Value.String()
+		}
+		if strings.HasPrefix(kctx, ".") {
+			return nil, fmt.Errorf("cluster %s is only known after build", kctx)
+		}
+		return getK8sConfig(kctx)
+	}
 
 	// build
-	v, err := build.Build(factory.GetBuildContext(cmd), &load.Config{
-		Tags:    opts.Tags,
-		TagVars: load.DefaultTagVars(),
+	v, err := build.BuildWith(factory.GetBuildContext(cmd), build.Options{
+		Load: &load.Config{
+			Tags:    opts.Tags,
+			TagVars: load.DefaultTagVars(),
+		},
+		Cluster:   cluster,
+		Sensitive: sens,
+		Context:   cmd.Context(),
+		AllowExec: opts.AllowExec,
+		Workers:   opts.Workers,
 	})
+	secrets := sens.Values(v)
+	ctx := cmd.Context()
+	cmd.SetContext(log.WithLogger(ctx, sensitive.NewLogger(log.GetLogger(ctx), secrets)))
 	if err != nil {
-		return nil, cue.Value{}, fmt.Errorf("could not build context: %w", err)
+		return nil, cue.Value{}, fmt.Errorf("could not build context: %w", errors.New(sensitive.Redact(err.Error(), secrets)))
 	}
 
 	// parse paths
@@ -136,7 +176,7 @@ func manifetsFrom(cmd *cobra.Command) ([]manifest.Manifest, cue.Value, error) {
 	// extract manifests
 	mfs, err := manifest.Extract(v, paths...)
 	if err != nil {
-		return nil, v, fmt.Errorf("failed to extract manifests: %w", err)
+		return nil, v, fmt.Errorf("failed to extract manifests: %w", errors.New(sensitive.Redact(err.Error(), secrets)))
 	}
 	if len(mfs) <= 0 {
 		return nil, v, fmt.Errorf("no manifest found")
@@ -0,0 +1,81 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/loft-orbital/cuebe/cmd/cuebe/factory"
+	"github.com/spf13/cobra"
+)
+
+func newContextCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "context",
+		Short: "Inspect build contexts.",
+		Long: `
+Inspect build contexts, without building them.
+`,
+	}
+
+	cmd.AddCommand(newContextLsCmd())
+
+	return cmd
+}
+
+func newContextLsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls",
+		Short: "List context files and their origin.",
+		Long: `
+List every file of the merged context and the argument (layer) it comes from.
+
+Files provided by several arguments are listed once per argument.
+Only the last one is used, the others are marked as overridden.
+`,
+		Example: `
+# List files of a base directory merged with an overlay
+cuebe context ls base/ overlay/
+
+# Fail if overlay/ shadows a file of base/
+cuebe context ls --on-conflict=error base/ overlay/
+`,
+		Run: runContextLs,
+	}
+
+	factory.BuildContextAware(cmd)
+
+	return cmd
+}
+
+func runContextLs(cmd *cobra.Command, args []string) {
+	ctx := factory.GetBuildContext(cmd)
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 8, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "PATH\tLAYER\tSTATUS")
+	for _, f := range ctx.Files() {
+		for i, l := range f.Layers {
+			status := "active"
+			if i < len(f.Layers)-1 {
+				status = "overridden"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", f.Path, l, status)
+		}
+	}
+}
@@ -17,6 +17,8 @@ package cmd
 
 import (
 	"github.com/loft-orbital/cuebe/cmd/cuebe/factory"
+	"github.com/loft-orbital/cuebe/pkg/manifest"
+	"github.com/loft-orbital/cuebe/pkg/sensitive"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 )
@@ -29,10 +31,19 @@ func newExportCmd() *cobra.Command {
 		Long: `
 Export CUE release as a kubectl-compatible multi document YAML manifest.
 If --output is set, manifests will be written here, one file by instances.
+
+Sensitive values, read from encrypted files, Secrets or commands, or injected with sensitive=true,
+are replaced by <redacted> unless --show-secrets is set.
 		`,
 		Example: `
 # Export current directory with an encrypted file override
-cuebe export -i main.enc.yaml
+cuebe export . main.enc.yaml
+
+# Export the HEAD of a git repository, without a temporary directory
+git archive HEAD | cuebe export -
+
+# Export with the decrypted values in plain text
+cuebe export . --show-secrets
 `,
 		Run: runExport,
 	}
@@ -40,12 +51,19 @@ cuebe export -i main.enc.yaml
 	factory.BuildAware(cmd)
 	factory.BuildContextAware(cmd)
 
+	cmd.Flags().Bool("show-secrets", false, "Export sensitive values in plain text instead of redacting them.")
 	return cmd
 }
 
 func runExport(cmd *cobra.Command, args []string) {
-	mfs, _, err := manifetsFrom(cmd)
+	sens := sensitive.NewPaths()
+	mfs, v, err := manifetsFrom(cmd, sens)
 	cobra.CheckErr(err)
+	show, err := cmd.Flags().GetBool("show-secrets")
+	cobra.CheckErr(err)
+	if !show {
+		mfs = manifest.Redact(v, mfs, sens.List())
+	}
 
 	// render
 	w := cmd.OutOrStdout()
@@ -0,0 +1,103 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/loft-orbital/cuebe/cmd/cuebe/factory"
+	"github.com/loft-orbital/cuebe/pkg/cube"
+	"github.com/loft-orbital/cuebe/pkg/instance"
+	"github.com/spf13/cobra"
+)
+
+func newInspectCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect <cube>",
+		Short: "Describe what a cube deploys.",
+		Long: `
+Inspect a cube without touching any cluster.
+
+It prints the cube metadata, its files, then builds it and lists
+the instances and manifests it would produce with the given tags.
+Several contexts can be given, they are merged as for apply.
+`,
+		Example: `
+# Inspect a cube
+cuebe inspect cube.tar.gz
+
+# Inspect a remote cube as it would be deployed in production
+cuebe inspect https://host/cube.tar.gz -t env=prod
+`,
+		Run: runInspect,
+	}
+
+	factory.BuildAware(cmd)
+	factory.BuildContextAware(cmd)
+
+	return cmd
+}
+
+func runInspect(cmd *cobra.Command, args []string) {
+	ctx := factory.GetBuildContext(cmd)
+	out := cmd.OutOrStdout()
+
+	meta, err := cube.ReadMetadata(ctx.GetAferoFS())
+	switch {
+	case err == nil:
+		w := tabwriter.NewWriter(out, 0, 8, 1, ' ', 0)
+		fmt.Fprintf(w, "Module:\t%s\n", meta.Module)
+		fmt.Fprintf(w, "Commit:\t%s\n", meta.Commit)
+		fmt.Fprintf(w, "Cuebe version:\t%s\n", meta.CuebeVersion)
+		fmt.Fprintf(w, "Created:\t%s\n", meta.Created.Format(time.RFC3339))
+		fmt.Fprintf(w, "Tags:\t%s\n", strings.Join(meta.Tags, ", "))
+		cobra.CheckErr(w.Flush())
+	case errors.Is(err, os.ErrNotExist):
+		fmt.Fprintln(out, "No metadata.")
+	default:
+		cobra.CheckErr(err)
+	}
+
+	fmt.Fprintln(out, "\nFiles:")
+	for _, f := range ctx.Files() {
+		fmt.Fprintf(out, "  %s\n", f.Path)
+	}
+
+	mfs, _, err := manifetsFrom(cmd, nil)
+	cobra.CheckErr(err)
+	// sorted, so that inspecting the same cube twice gives the same output
+	instances := instance.Split(mfs)
+	sort.Slice(instances, func(i, j int) bool { return instances[i].String() < instances[j].String() })
+
+	fmt.Fprintln(out, "\nInstances:")
+	for _, i := range instances {
+		fmt.Fprintf(out, "  %s\n", i)
+		ids := make([]string, 0, len(i.Manifests()))
+		for _, m := range i.Manifests() {
+			ids = append(ids, m.Id().String())
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			fmt.Fprintf(out, "    %s\n", id)
+		}
+	}
+}
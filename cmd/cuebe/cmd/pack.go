@@ -16,12 +16,17 @@ limitations under the License.
 package cmd
 
 import (
-	"archive/tar"
-	"compress/gzip"
-	"io"
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
 	"os"
+	"strconv"
+	"time"
 
+	gogit "github.com/go-git/go-git/v5"
 	"github.com/loft-orbital/cuebe/cmd/cuebe/factory"
+	"github.com/loft-orbital/cuebe/pkg/context"
+	"github.com/loft-orbital/cuebe/pkg/cube"
 	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 )
@@ -35,6 +40,22 @@ Package a context into a tar.gz archive.
 This archive can be used later as a base context.
 
 Package respects the .cuebeignore directives.
+
+Packing is reproducible: the same content always produces the same archive,
+whatever the files timestamps, ownership or the machine it is packed on.
+The sha256 digest of the archive is printed once packed.
+
+The archive embeds a .cuebe/metadata.json file recording the CUE module path,
+the declared tags, the cuebe version and, when packing from a git repository,
+the source commit. The creation time is SOURCE_DATE_EPOCH if set, the source
+commit time otherwise, falling back to the Unix epoch. Since the cuebe version is
+recorded, packing with another cuebe version gives another digest.
+
+With --sign, a detached ed25519 signature of the archive is written next to it,
+with a .sig extension. Keys are PEM encoded, as generated by openssl:
+
+  openssl genpkey -algorithm ed25519 -out cuebe.key
+  openssl pkey -in cuebe.key -pubout -out cuebe.pub
 `,
 		Example: `
 # Pack current directory
@@ -42,6 +63,12 @@ cuebe pack .
 
 # Merge dir1/ and dir2/ and pack them
 cuebe pack dir1/ dir2/
+
+# Pack current directory and write its digest, in sha256sum format
+cuebe pack . --digest-file cube.tar.gz.sha256
+
+# Pack and sign current directory, producing cube.tar.gz and cube.tar.gz.sig
+cuebe pack . --sign cuebe.key
 `,
 		Run: runPackage,
 	}
@@ -50,53 +77,101 @@ cuebe pack dir1/ dir2/
 
 	fs := cmd.Flags()
 	fs.StringP("output", "o", "cube.tar.gz", "Output file.")
+	fs.String("digest-file", "", "Write the archive digest to this file.")
+	fs.String("sign", "", "Sign the archive with this ed25519 private key (PEM).")
 
 	return cmd
 }
 
 func runPackage(cmd *cobra.Command, args []string) {
 	ctx := factory.GetBuildContext(cmd)
-	fs := ctx.GetAferoFS()
 	filename, err := cmd.Flags().GetString("output")
 	cobra.CheckErr(err)
+	digestFile, err := cmd.Flags().GetString("digest-file")
+	cobra.CheckErr(err)
 
-	out, err := os.Create(filename)
+	keyFile, err := cmd.Flags().GetString("sign")
 	cobra.CheckErr(err)
-	defer out.Close()
+	var key ed25519.PrivateKey
+	if keyFile != "" {
+		key, err = cube.ReadPrivateKey(keyFile)
+		cobra.CheckErr(err)
+	}
 
-	gw := gzip.NewWriter(out)
-	defer gw.Close()
-	tw := tar.NewWriter(gw)
-	defer tw.Close()
+	meta, err := packMetadata(ctx.GetAferoFS(), args)
+	cobra.CheckErr(err)
+	fs, err := cube.WithMetadata(ctx.GetAferoFS(), meta)
+	cobra.CheckErr(err)
+
+	buf := new(bytes.Buffer)
+	digest, err := cube.Pack(buf, fs)
+	cobra.CheckErr(err)
+	cobra.CheckErr(os.WriteFile(filename, buf.Bytes(), 0644))
 
-	cobra.CheckErr(afero.Walk(fs, "", func(path string, info os.FileInfo, err error) error {
+	if key != nil {
+		cobra.CheckErr(os.WriteFile(filename+cube.SignatureExt, cube.Sign(key, buf.Bytes()), 0644))
+	}
+
+	if digestFile != "" {
+		// sha256sum compatible
+		line := fmt.Sprintf("%s  %s\n", digest[len("sha256:"):], filename)
+		cobra.CheckErr(os.WriteFile(digestFile, []byte(line), 0644))
+	}
+	fmt.Fprintln(cmd.OutOrStdout(), digest)
+}
+
+// packMetadata collects the metadata of a cube packed from args.
+func packMetadata(fs afero.Fs, args []string) (*cube.Metadata, error) {
+	m, err := cube.NewMetadata(fs)
+	if err != nil {
+		return nil, fmt.Errorf("could not collect metadata: %w", err)
+	}
+	m.CuebeVersion = version
+
+	var committed time.Time
+	m.Commit, committed = sourceCommit(args)
+	m.Created = committed
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		sec, err := strconv.ParseInt(epoch, 10, 64)
 		if err != nil {
-			return err
-		}
-		if path == "" {
-			return nil
+			return nil, fmt.Errorf("invalid SOURCE_DATE_EPOCH: %w", err)
 		}
+		m.Created = time.Unix(sec, 0)
+	}
+	if m.Created.IsZero() {
+		// like the tar entries, to stay reproducible
+		m.Created = time.Unix(0, 0)
+	}
+	m.Created = m.Created.UTC().Truncate(time.Second)
 
-		// create header
-		header, err := tar.FileInfoHeader(info, info.Name())
+	return m, nil
+}
+
+// sourceCommit returns the HEAD commit, and its time, of the git repository
+// containing the first local directory argument, mounted or not.
+// It is best effort: nothing is returned if no repository is found.
+func sourceCommit(args []string) (string, time.Time) {
+	for _, arg := range args {
+		src, _, err := context.SplitMount(arg)
 		if err != nil {
-			return err
+			continue
 		}
-		header.Name = path
-		//write header
-		if err := tw.WriteHeader(header); err != nil {
-			return err
+		if info, err := os.Stat(src); err != nil || !info.IsDir() {
+			continue
 		}
-		// open file
-		file, err := fs.Open(path)
+		r, err := gogit.PlainOpenWithOptions(src, &gogit.PlainOpenOptions{DetectDotGit: true})
 		if err != nil {
-			return err
+			continue
 		}
-		// copy file
-		if _, err := io.Copy(tw, file); err != nil {
-			return err
+		head, err := r.Head()
+		if err != nil {
+			continue
 		}
-
-		return nil
-	}))
+		c, err := r.CommitObject(head.Hash())
+		if err != nil {
+			continue
+		}
+		return c.Hash.String(), c.Committer.When
+	}
+	return "", time.Time{}
 }
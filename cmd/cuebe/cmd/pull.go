@@ -0,0 +1,64 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/loft-orbital/cuebe/internal/oci"
+	"github.com/loft-orbital/cuebe/pkg/cube"
+	"github.com/spf13/cobra"
+)
+
+func newPullCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "pull <reference>",
+		Short: "Pull a cube from an OCI registry.",
+		Long: `
+Pull a cube previously pushed to an OCI registry.
+Its detached signature, if pushed along, is written next to it (<output>.sig),
+ready for cuebe verify.
+`,
+		Example: `
+# Pull a cube by tag
+cuebe pull oci://ghcr.io/org/app:1.4.0
+
+# Pull a cube by digest
+cuebe pull -o app.tar.gz oci://ghcr.io/org/app@sha256:<hex>
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  runPull,
+	}
+
+	fs := cmd.Flags()
+	fs.StringP("output", "o", "cube.tar.gz", "Output file.")
+
+	return cmd
+}
+
+func runPull(cmd *cobra.Command, args []string) {
+	ref, err := oci.ParseReference(args[0])
+	cobra.CheckErr(err)
+	filename, err := cmd.Flags().GetString("output")
+	cobra.CheckErr(err)
+
+	data, sig, err := oci.PullSigned(cmd.Context(), ref)
+	cobra.CheckErr(err)
+	cobra.CheckErr(os.WriteFile(filename, data, 0644))
+	if sig != nil {
+		cobra.CheckErr(os.WriteFile(filename+cube.SignatureExt, sig, 0644))
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/loft-orbital/cuebe/internal/oci"
+	"github.com/loft-orbital/cuebe/pkg/cube"
+	"github.com/spf13/cobra"
+)
+
+func newPushCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "push <cube> <reference>",
+		Short: "Push a cube to an OCI registry.",
+		Long: `
+Push a cube to an OCI registry.
+
+The cube is stored as an OCI artifact, with its own config and layer media types.
+Its detached signature (<cube>.sig), if any, is pushed along as a second layer,
+so that the reference can be used with --require-signature.
+Once pushed, the reference can be used as a context, or pulled back with cuebe pull.
+
+Registry credentials are resolved like private modules:
+exporting **HOST_ADDRESS_TOKEN** and **HOST_ADDRESS_USER** environment variables
+or leveraging credentials within your ~/.netrc file.
+`,
+		Example: `
+# Pack and push the current directory
+cuebe pack -o cube.tar.gz .
+cuebe push cube.tar.gz oci://ghcr.io/org/app:1.4.0
+
+# Apply it later
+cuebe apply oci://ghcr.io/org/app:1.4.0
+
+# Push a signed cube, and only apply it if its signature is valid
+cuebe pack -o cube.tar.gz --sign cuebe.key .
+cuebe push cube.tar.gz oci://ghcr.io/org/app:1.4.0
+cuebe apply --require-signature cuebe.pub oci://ghcr.io/org/app:1.4.0
+`,
+		Args: cobra.ExactArgs(2),
+		Run:  runPush,
+	}
+
+	return cmd
+}
+
+func runPush(cmd *cobra.Command, args []string) {
+	ref, err := oci.ParseReference(args[1])
+	cobra.CheckErr(err)
+
+	data, err := os.ReadFile(args[0])
+	cobra.CheckErr(err)
+	if !cube.IsCube(bufio.NewReader(bytes.NewReader(data))) {
+		cobra.CheckErr(fmt.Errorf("%s is not a cube", args[0]))
+	}
+
+	sig, err := os.ReadFile(args[0] + cube.SignatureExt)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		cobra.CheckErr(fmt.Errorf("could not read signature: %w", err))
+	}
+
+	digest, err := oci.PushSigned(cmd.Context(), ref, data, sig)
+	cobra.CheckErr(err)
+	cmd.Printf("Pushed %s@%s\n", ref, digest)
+}
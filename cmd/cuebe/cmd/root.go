@@ -51,13 +51,19 @@ func Execute() {
 
 func init() {
 	RootCmd.PersistentFlags().Duration("timeout", 2*time.Minute, "Timeout, accpet any valid go Duration.")
+	RootCmd.PersistentFlags().Bool("debug", false, "Print debug messages, such as injection timings.")
 
 	RootCmd.AddCommand(
 		newApplyCmd(),
+		newContextCmd(),
 		newDeleteCmd(),
 		newExportCmd(),
+		newInspectCmd(),
 		newInstallCmd(),
 		newPackCmd(),
+		newPullCmd(),
+		newPushCmd(),
+		newVerifyCmd(),
 		newVersionCmd(),
 		mod.RootCmd,
 	)
@@ -66,12 +72,16 @@ func init() {
 func setContext(cmd *cobra.Command, args []string) {
 	timeout, err := cmd.Flags().GetDuration("timeout")
 	cobra.CheckErr(err)
+	debug, err := cmd.Flags().GetBool("debug")
+	cobra.CheckErr(err)
 
 	// add timeout
 	withTimeout, cancel := context.WithTimeout(cmd.Context(), timeout)
 	withCancel := context.WithValue(withTimeout, cancelKey{}, cancel)
 	// add logger
-	withLog := log.WithLogger(withCancel, log.NewIOLogger(cmd.OutOrStdout(), cmd.ErrOrStderr()))
+	logger := log.NewIOLogger(cmd.OutOrStdout(), cmd.ErrOrStderr())
+	logger.SetDebug(debug)
+	withLog := log.WithLogger(withCancel, logger)
 
 	cmd.SetContext(withLog)
 }
@@ -0,0 +1,74 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/loft-orbital/cuebe/pkg/cube"
+	"github.com/spf13/cobra"
+)
+
+func newVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify <cube>",
+		Short: "Verify the signature of a cube.",
+		Long: `
+Verify the detached signature of a cube against an ed25519 public key.
+The signature is read from the cube file name with a .sig extension,
+unless --signature is set.
+
+Exits with a non-zero status if the signature is missing or invalid.
+`,
+		Example: `
+# Verify cube.tar.gz against cube.tar.gz.sig
+cuebe verify cube.tar.gz --key cuebe.pub
+
+# Verify with a signature stored elsewhere
+cuebe verify cube.tar.gz --key cuebe.pub --signature signatures/cube.sig
+`,
+		Args: cobra.ExactArgs(1),
+		Run:  runVerify,
+	}
+
+	fs := cmd.Flags()
+	fs.String("key", "", "ed25519 public key (PEM).")
+	fs.String("signature", "", "Signature file. Defaults to <cube>.sig.")
+	cobra.CheckErr(cmd.MarkFlagRequired("key"))
+
+	return cmd
+}
+
+func runVerify(cmd *cobra.Command, args []string) {
+	keyFile, err := cmd.Flags().GetString("key")
+	cobra.CheckErr(err)
+	sigFile, err := cmd.Flags().GetString("signature")
+	cobra.CheckErr(err)
+	if sigFile == "" {
+		sigFile = args[0] + cube.SignatureExt
+	}
+
+	key, err := cube.ReadPublicKey(keyFile)
+	cobra.CheckErr(err)
+	data, err := os.ReadFile(args[0])
+	cobra.CheckErr(err)
+	sig, err := os.ReadFile(sigFile)
+	cobra.CheckErr(err)
+
+	cobra.CheckErr(cube.Verify(key, data, sig))
+	fmt.Fprintf(cmd.OutOrStdout(), "%s: signature verified\n", args[0])
+}
@@ -3,6 +3,7 @@ package factory
 import (
 	"context"
 
+	"github.com/loft-orbital/cuebe/pkg/injector"
 	"github.com/spf13/cobra"
 )
 
@@ -11,6 +12,10 @@ type BuildOpt struct {
 	Expressions []string
 	// Tags are a list of key value used as CUE tags.
 	Tags []string
+	// AllowExec lists the executables exec injections may run.
+	AllowExec []string
+	// Workers is the number of injections prepared concurrently.
+	Workers int
 }
 
 type buildKey struct{}
@@ -29,6 +34,8 @@ func BuildAware(cmd *cobra.Command) {
 	f := cmd.Flags()
 	f.StringArrayP("expression", "e", []string{}, "Expressions to extract manifests from. Default to root.")
 	f.StringArrayP("tag", "t", []string{}, "Inject boolean or key=value tag.")
+	f.StringArray("allow-exec", []string{}, "Executable exec injections may run. Can be repeated.")
+	f.Int("injection-workers", injector.DefaultWorkers, "Number of injections (file reads and decryptions, HTTP requests, commands...) run concurrently.")
 
 	AppendPreRun(cmd, buildPreRun)
 }
@@ -48,5 +55,11 @@ func buildPreRun(cmd *cobra.Command, args []string) {
 	bo.Tags, err = fs.GetStringArray("tag")
 	cobra.CheckErr(err)
 
+	bo.AllowExec, err = fs.GetStringArray("allow-exec")
+	cobra.CheckErr(err)
+
+	bo.Workers, err = fs.GetInt("injection-workers")
+	cobra.CheckErr(err)
+
 	cmd.SetContext(context.WithValue(cmd.Context(), buildKey{}, bo))
 }
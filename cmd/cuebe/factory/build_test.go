@@ -34,4 +34,6 @@ func TestBuildAware(t *testing.T) {
 	assert.NotNil(t, cmd.PreRun)
 	assert.NotNil(t, cmd.Flags().Lookup("expression"))
 	assert.NotNil(t, cmd.Flags().Lookup("tag"))
+	assert.NotNil(t, cmd.Flags().Lookup("allow-exec"))
+	assert.NotNil(t, cmd.Flags().Lookup("injection-workers"))
 }
@@ -19,6 +19,7 @@ import (
 	"context"
 
 	buildctx "github.com/loft-orbital/cuebe/pkg/context"
+	"github.com/loft-orbital/cuebe/pkg/cube"
 
 	"github.com/spf13/cobra"
 )
@@ -34,14 +35,33 @@ func GetBuildContext(cmd *cobra.Command) *buildctx.Context {
 }
 
 // BuildContextAware marks a command as aware of a build Context.
-// It adds an args validation and the required PreRunE function.
+// It adds an args validation, the proper flags and the required PreRunE function.
 func BuildContextAware(cmd *cobra.Command) {
 	cmd.Args = cobra.MinimumNArgs(1)
+
+	f := cmd.Flags()
+	f.String("on-conflict", string(buildctx.OnConflictOverride), "What to do when a context argument overrides a file with a different content: error, warn or override.")
+	f.String("require-signature", "", "Only accept cubes signed with the private key matching this ed25519 public key (PEM). Git repositories are refused.")
+
 	AppendPreRun(cmd, bctxPreRun)
 }
 
 func bctxPreRun(cmd *cobra.Command, args []string) {
-	bctx, err := buildctx.FromArgs(args)
+	opts := &buildctx.Options{Stdin: cmd.InOrStdin()}
+
+	oc, err := cmd.Flags().GetString("on-conflict")
+	cobra.CheckErr(err)
+	opts.OnConflict, err = buildctx.ParseConflictStrategy(oc)
+	cobra.CheckErr(err)
+
+	pub, err := cmd.Flags().GetString("require-signature")
+	cobra.CheckErr(err)
+	if pub != "" {
+		opts.PublicKey, err = cube.ReadPublicKey(pub)
+		cobra.CheckErr(err)
+	}
+
+	bctx, err := buildctx.FromArgs(cmd.Context(), args, opts)
 	cobra.CheckErr(err)
 
 	cmd.SetContext(context.WithValue(cmd.Context(), bctxKey{}, bctx))
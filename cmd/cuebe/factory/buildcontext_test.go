@@ -31,4 +31,6 @@ func TestBuildContextAware(t *testing.T) {
 	BuildContextAware(cmd)
 	assert.NotNil(t, cmd.PreRun)
 	assert.NotNil(t, cmd.Args)
+	assert.NotNil(t, cmd.Flags().Lookup("on-conflict"))
+	assert.NotNil(t, cmd.Flags().Lookup("require-signature"))
 }
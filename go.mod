@@ -4,6 +4,7 @@ go 1.17
 
 require (
 	cuelang.org/go v0.4.3
+	github.com/BurntSushi/toml v1.2.1
 	github.com/PaesslerAG/jsonpath v0.1.1
 	github.com/go-git/go-billy/v5 v5.3.1
 	github.com/go-git/go-git/v5 v5.4.2
@@ -0,0 +1,175 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/loft-orbital/cuebe/internal/mod"
+	"github.com/loft-orbital/cuebe/internal/utils"
+)
+
+// client is a minimal OCI distribution client scoped to a single repository.
+type client struct {
+	ref *Reference
+	usr string
+	pwd string
+	// authorization is the Authorization header to send, once negotiated.
+	authorization string
+}
+
+func newClient(ref *Reference) *client {
+	usr, pwd := mod.CredentialsFor(ref.hostname())
+	return &client{ref: ref, usr: usr, pwd: pwd}
+}
+
+// do sends a request to the registry.
+// On 401 responses it negotiates credentials following the WWW-Authenticate challenge
+// and retries once.
+func (c *client) do(ctx context.Context, method, u string, data []byte, header http.Header) (*http.Response, error) {
+	resp, err := c.send(ctx, method, u, data, header)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	if err := c.authorize(ctx, resp.Header.Get("WWW-Authenticate")); err != nil {
+		return nil, fmt.Errorf("could not authenticate to %s: %w", c.ref.Host, err)
+	}
+	return c.send(ctx, method, u, data, header)
+}
+
+func (c *client) send(ctx context.Context, method, u string, data []byte, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body(data))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// authorize negotiates the Authorization header from a WWW-Authenticate challenge.
+func (c *client) authorize(ctx context.Context, challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.pwd == "" {
+			return fmt.Errorf("no credentials found for %s", c.ref.hostname())
+		}
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(c.usr, c.pwd)
+		c.authorization = req.Header.Get("Authorization")
+		return nil
+	case "bearer":
+		token, err := c.token(ctx, params)
+		if err != nil {
+			return err
+		}
+		c.authorization = "Bearer " + token
+		return nil
+	default:
+		return fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+}
+
+// token fetches a bearer token from the challenge realm.
+func (c *client) token(ctx context.Context, params map[string]string) (string, error) {
+	realm, ok := params["realm"]
+	if !ok {
+		return "", fmt.Errorf("missing realm in bearer challenge")
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("invalid realm: %w", err)
+	}
+	q := u.Query()
+	if s, ok := params["service"]; ok {
+		q.Set("service", s)
+	}
+	scope, ok := params["scope"]
+	if !ok {
+		scope = fmt.Sprintf("repository:%s:pull,push", c.ref.Repository)
+	}
+	q.Set("scope", scope)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.pwd != "" {
+		req.SetBasicAuth(c.usr, c.pwd)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("could not get token: unexpected status %s", resp.Status)
+	}
+
+	var tr struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", fmt.Errorf("could not decode token: %w", err)
+	}
+	if tr.Token != "" {
+		return tr.Token, nil
+	}
+	if tr.AccessToken != "" {
+		return tr.AccessToken, nil
+	}
+	return "", fmt.Errorf("empty token")
+}
+
+// parseChallenge parses a WWW-Authenticate header value,
+// e.g. Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+	scheme, rest, _ := utils.Cut(strings.TrimSpace(challenge), " ")
+	for rest != "" {
+		var kv string
+		rest = strings.TrimLeft(rest, " ,")
+		key, value, found := utils.Cut(rest, "=")
+		if !found {
+			break
+		}
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				break
+			}
+			kv, rest = value[1:end+1], value[end+2:]
+		} else {
+			kv, rest, _ = utils.Cut(value, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = kv
+	}
+	return scheme, params
+}
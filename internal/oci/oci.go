@@ -0,0 +1,248 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oci
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const (
+	// ManifestMediaType is the media type of OCI image manifests.
+	ManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	// ConfigMediaType is the media type of the cube config blob.
+	ConfigMediaType = "application/vnd.loftorbital.cuebe.config.v1+json"
+	// CubeMediaType is the media type of the cube layer.
+	CubeMediaType = "application/vnd.loftorbital.cuebe.cube.v1.tar+gzip"
+	// SignatureMediaType is the media type of the detached cube signature layer.
+	SignatureMediaType = "application/vnd.loftorbital.cuebe.cube.signature.v1"
+)
+
+// Descriptor describes an OCI blob.
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Manifest is an OCI image manifest.
+type Manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Config        Descriptor   `json:"config"`
+	Layers        []Descriptor `json:"layers"`
+}
+
+// Push uploads a cube to the registry at ref.
+// It returns the digest of the pushed manifest.
+func Push(ctx context.Context, ref *Reference, cube []byte) (string, error) {
+	return PushSigned(ctx, ref, cube, nil)
+}
+
+// PushSigned uploads a cube and its detached signature, if not nil, to the registry at ref.
+// The signature is stored as a second layer of the artifact.
+// It returns the digest of the pushed manifest.
+func PushSigned(ctx context.Context, ref *Reference, cube, sig []byte) (string, error) {
+	c := newClient(ref)
+
+	type blob struct {
+		desc Descriptor
+		data []byte
+	}
+	config := []byte("{}")
+	cfgDesc := descriptorFor(ConfigMediaType, config)
+	cubeDesc := descriptorFor(CubeMediaType, cube)
+	cubeDesc.Annotations = map[string]string{"org.opencontainers.image.title": "cube.tar.gz"}
+	blobs := []blob{{cfgDesc, config}, {cubeDesc, cube}}
+	layers := []Descriptor{cubeDesc}
+	if sig != nil {
+		sigDesc := descriptorFor(SignatureMediaType, sig)
+		sigDesc.Annotations = map[string]string{"org.opencontainers.image.title": "cube.tar.gz.sig"}
+		blobs = append(blobs, blob{sigDesc, sig})
+		layers = append(layers, sigDesc)
+	}
+	for _, b := range blobs {
+		if err := c.pushBlob(ctx, b.desc, b.data); err != nil {
+			return "", fmt.Errorf("could not push blob %s: %w", b.desc.Digest, err)
+		}
+	}
+
+	manifest, err := json.Marshal(Manifest{
+		SchemaVersion: 2,
+		MediaType:     ManifestMediaType,
+		Config:        cfgDesc,
+		Layers:        layers,
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not marshal manifest: %w", err)
+	}
+	resp, err := c.do(ctx, http.MethodPut, c.url("manifests", ref.Identifier()), manifest, http.Header{
+		"Content-Type": []string{ManifestMediaType},
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not push manifest: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("could not push manifest: unexpected status %s", resp.Status)
+	}
+
+	return digest(manifest), nil
+}
+
+// Pull downloads the cube stored in the registry at ref.
+func Pull(ctx context.Context, ref *Reference) ([]byte, error) {
+	cube, _, err := PullSigned(ctx, ref)
+	return cube, err
+}
+
+// PullSigned downloads the cube stored in the registry at ref and its detached signature,
+// nil if it was pushed without.
+func PullSigned(ctx context.Context, ref *Reference) (cube, sig []byte, err error) {
+	c := newClient(ref)
+
+	data, err := c.get(ctx, c.url("manifests", ref.Identifier()), ManifestMediaType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not get manifest: %w", err)
+	}
+	if ref.Digest != "" && digest(data) != ref.Digest {
+		return nil, nil, fmt.Errorf("manifest digest mismatch: expected %s, got %s", ref.Digest, digest(data))
+	}
+	m := new(Manifest)
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, nil, fmt.Errorf("could not unmarshal manifest: %w", err)
+	}
+	if m.Config.MediaType != ConfigMediaType {
+		return nil, nil, fmt.Errorf("%s is not a cube: unexpected config media type %s", ref, m.Config.MediaType)
+	}
+
+	for _, l := range m.Layers {
+		switch l.MediaType {
+		case CubeMediaType:
+			if cube, err = c.getBlob(ctx, l); err != nil {
+				return nil, nil, fmt.Errorf("could not get cube: %w", err)
+			}
+		case SignatureMediaType:
+			if sig, err = c.getBlob(ctx, l); err != nil {
+				return nil, nil, fmt.Errorf("could not get signature: %w", err)
+			}
+		}
+	}
+	if cube == nil {
+		return nil, nil, fmt.Errorf("%s has no cube layer", ref)
+	}
+	return cube, sig, nil
+}
+
+// getBlob downloads the blob desc describes, checking its digest.
+func (c *client) getBlob(ctx context.Context, desc Descriptor) ([]byte, error) {
+	data, err := c.get(ctx, c.url("blobs", desc.Digest), "")
+	if err != nil {
+		return nil, err
+	}
+	if digest(data) != desc.Digest {
+		return nil, fmt.Errorf("digest mismatch: expected %s, got %s", desc.Digest, digest(data))
+	}
+	return data, nil
+}
+
+func (c *client) pushBlob(ctx context.Context, desc Descriptor, data []byte) error {
+	resp, err := c.do(ctx, http.MethodHead, c.url("blobs", desc.Digest), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		// already uploaded
+		return nil
+	}
+
+	resp, err = c.do(ctx, http.MethodPost, c.url("blobs", "uploads/"), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("could not start upload: unexpected status %s", resp.Status)
+	}
+	loc, err := resp.Location()
+	if err != nil {
+		return fmt.Errorf("could not get upload location: %w", err)
+	}
+	q := loc.Query()
+	q.Set("digest", desc.Digest)
+	loc.RawQuery = q.Encode()
+
+	resp, err = c.do(ctx, http.MethodPut, loc.String(), data, http.Header{
+		"Content-Type": []string{"application/octet-stream"},
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("could not upload: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func (c *client) get(ctx context.Context, u, accept string) ([]byte, error) {
+	header := http.Header{}
+	if accept != "" {
+		header.Set("Accept", accept)
+	}
+	resp, err := c.do(ctx, http.MethodGet, u, nil, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (c *client) url(kind, id string) string {
+	u := url.URL{
+		Scheme: c.ref.scheme(),
+		Host:   c.ref.Host,
+		Path:   fmt.Sprintf("/v2/%s/%s/%s", c.ref.Repository, kind, id),
+	}
+	return u.String()
+}
+
+func descriptorFor(mediaType string, data []byte) Descriptor {
+	return Descriptor{MediaType: mediaType, Digest: digest(data), Size: int64(len(data))}
+}
+
+func digest(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// body returns a reader over data, or nil if data is nil.
+func body(data []byte) io.Reader {
+	if data == nil {
+		return nil
+	}
+	return bytes.NewReader(data)
+}
@@ -0,0 +1,211 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oci
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// registry is a minimal in-memory OCI registry.
+type registry struct {
+	sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string][]byte
+	// token, when set, is required as bearer token.
+	token string
+}
+
+func newRegistry(token string) *httptest.Server {
+	r := &registry{blobs: map[string][]byte{}, manifests: map[string][]byte{}, token: token}
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.serve(srv.URL, w, req)
+	})
+	srv.Start()
+	return srv
+}
+
+func (r *registry) serve(base string, w http.ResponseWriter, req *http.Request) {
+	r.Lock()
+	defer r.Unlock()
+
+	if req.URL.Path == "/token" {
+		fmt.Fprintf(w, `{"token": %q}`, r.token)
+		return
+	}
+	if r.token != "" && req.Header.Get("Authorization") != "Bearer "+r.token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, base))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	p := strings.TrimPrefix(req.URL.Path, "/v2/")
+	switch {
+	case strings.Contains(p, "/blobs/uploads/") && req.Method == http.MethodPost:
+		w.Header().Set("Location", "/v2/"+p+"session?state=potato")
+		w.WriteHeader(http.StatusAccepted)
+	case strings.Contains(p, "/blobs/uploads/") && req.Method == http.MethodPut:
+		data, _ := io.ReadAll(req.Body)
+		d := req.URL.Query().Get("digest")
+		if d != digest(data) || req.URL.Query().Get("state") != "potato" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.blobs[d] = data
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(p, "/blobs/"):
+		data, ok := r.blobs[p[strings.LastIndex(p, "/")+1:]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case strings.Contains(p, "/manifests/") && req.Method == http.MethodPut:
+		data, _ := io.ReadAll(req.Body)
+		repo := p[:strings.Index(p, "/manifests/")]
+		r.manifests[p] = data
+		r.manifests[repo+"/manifests/"+digest(data)] = data
+		w.WriteHeader(http.StatusCreated)
+	case strings.Contains(p, "/manifests/"):
+		data, ok := r.manifests[p]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", ManifestMediaType)
+		w.Write(data)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	d := "sha256:" + strings.Repeat("a", 64)
+	tcs := map[string]struct {
+		ref      string
+		expected *Reference
+	}{
+		"tag":     {"oci://registry/org/app:1.4.0", &Reference{Host: "registry", Repository: "org/app", Tag: "1.4.0"}},
+		"latest":  {"oci://registry/app", &Reference{Host: "registry", Repository: "app", Tag: "latest"}},
+		"port":    {"oci://localhost:5000/org/app", &Reference{Host: "localhost:5000", Repository: "org/app", Tag: "latest"}},
+		"digest":  {"oci://registry/org/app@" + d, &Reference{Host: "registry", Repository: "org/app", Digest: d}},
+		"nesting": {"oci://r.io:443/a/b/c:v1", &Reference{Host: "r.io:443", Repository: "a/b/c", Tag: "v1"}},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			ref, err := ParseReference(tc.ref)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, ref)
+		})
+	}
+
+	ref, err := ParseReference("oci://registry/app")
+	require.NoError(t, err)
+	assert.Equal(t, "oci://registry/app:latest", ref.String())
+	ref, err = ParseReference("oci://registry/app@" + d)
+	require.NoError(t, err)
+	assert.Equal(t, "oci://registry/app@"+d, ref.String())
+
+	for _, bad := range []string{"registry/app", "oci://registry", "oci://registry/App", "oci://registry/app:!", "oci://registry/app@sha256:potato"} {
+		_, err := ParseReference(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestScheme(t *testing.T) {
+	assert.Equal(t, "http", (&Reference{Host: "localhost:5000"}).scheme())
+	assert.Equal(t, "http", (&Reference{Host: "127.0.0.1:5000"}).scheme())
+	assert.Equal(t, "http", (&Reference{Host: "[::1]:5000"}).scheme())
+	assert.Equal(t, "https", (&Reference{Host: "ghcr.io"}).scheme())
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:org/app:pull"`)
+	assert.Equal(t, "Bearer", scheme)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:org/app:pull",
+	}, params)
+
+	scheme, params = parseChallenge(`Basic realm=registry`)
+	assert.Equal(t, "Basic", scheme)
+	assert.Equal(t, map[string]string{"realm": "registry"}, params)
+}
+
+func TestPushPull(t *testing.T) {
+	t.Setenv("NETRC", "/dev/null")
+
+	for name, token := range map[string]string{"anonymous": "", "bearer": "s3cr3t"} {
+		t.Run(name, func(t *testing.T) {
+			srv := newRegistry(token)
+			defer srv.Close()
+			host := strings.TrimPrefix(srv.URL, "http://")
+			ctx := context.Background()
+			cube := []byte("not really a cube")
+
+			ref, err := ParseReference(fmt.Sprintf("oci://%s/org/app:1.4.0", host))
+			require.NoError(t, err)
+			d, err := Push(ctx, ref, cube)
+			require.NoError(t, err)
+
+			// pushing twice skips existing blobs
+			_, err = Push(ctx, ref, cube)
+			require.NoError(t, err)
+
+			actual, err := Pull(ctx, ref)
+			require.NoError(t, err)
+			assert.Equal(t, cube, actual)
+
+			// by digest
+			ref, err = ParseReference(fmt.Sprintf("oci://%s/org/app@%s", host, d))
+			require.NoError(t, err)
+			actual, err = Pull(ctx, ref)
+			require.NoError(t, err)
+			assert.Equal(t, cube, actual)
+
+			_, sig, err := PullSigned(ctx, ref)
+			require.NoError(t, err)
+			assert.Nil(t, sig)
+
+			// signed
+			ref, err = ParseReference(fmt.Sprintf("oci://%s/org/app:signed", host))
+			require.NoError(t, err)
+			_, err = PushSigned(ctx, ref, cube, []byte("signature"))
+			require.NoError(t, err)
+			actual, sig, err = PullSigned(ctx, ref)
+			require.NoError(t, err)
+			assert.Equal(t, cube, actual)
+			assert.Equal(t, []byte("signature"), sig)
+
+			// missing
+			ref, err = ParseReference(fmt.Sprintf("oci://%s/org/app:missing", host))
+			require.NoError(t, err)
+			_, err = Pull(ctx, ref)
+			assert.ErrorContains(t, err, "unexpected status 404 Not Found")
+		})
+	}
+}
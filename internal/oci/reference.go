@@ -0,0 +1,125 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package oci
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// Scheme is the prefix of OCI references.
+const Scheme = "oci://"
+
+var (
+	repositoryRe = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|[-]*)[a-z0-9]+)*)*$`)
+	tagRe        = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+	digestRe     = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+)
+
+// Reference points to an artifact in an OCI registry.
+type Reference struct {
+	// Host is the registry host, with an optional port.
+	Host string
+	// Repository is the artifact repository, e.g. org/app.
+	Repository string
+	// Tag is the artifact tag. Ignored if Digest is set.
+	Tag string
+	// Digest is the artifact manifest digest.
+	Digest string
+}
+
+// IsReference returns true if s looks like an OCI reference.
+func IsReference(s string) bool {
+	return strings.HasPrefix(s, Scheme)
+}
+
+// ParseReference parses an oci://host/repository[:tag|@digest] reference.
+// The tag defaults to latest.
+func ParseReference(s string) (*Reference, error) {
+	if !IsReference(s) {
+		return nil, fmt.Errorf("invalid reference %s: missing %s scheme", s, Scheme)
+	}
+	rest := strings.TrimPrefix(s, Scheme)
+	i := strings.Index(rest, "/")
+	if i <= 0 {
+		return nil, fmt.Errorf("invalid reference %s: missing repository", s)
+	}
+	ref := &Reference{Host: rest[:i], Tag: "latest"}
+	rest = rest[i+1:]
+
+	if i := strings.Index(rest, "@"); i >= 0 {
+		ref.Digest, ref.Tag = rest[i+1:], ""
+		rest = rest[:i]
+		if !digestRe.MatchString(ref.Digest) {
+			return nil, fmt.Errorf("invalid reference %s: invalid digest %s", s, ref.Digest)
+		}
+	} else if i := strings.LastIndex(rest, ":"); i > strings.LastIndex(rest, "/") {
+		ref.Tag = rest[i+1:]
+		rest = rest[:i]
+		if !tagRe.MatchString(ref.Tag) {
+			return nil, fmt.Errorf("invalid reference %s: invalid tag %s", s, ref.Tag)
+		}
+	}
+
+	if !repositoryRe.MatchString(rest) {
+		return nil, fmt.Errorf("invalid reference %s: invalid repository %s", s, rest)
+	}
+	ref.Repository = rest
+
+	return ref, nil
+}
+
+// Identifier returns the digest of the reference if set, its tag otherwise.
+func (r *Reference) Identifier() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+// String returns the reference in its oci:// form.
+func (r *Reference) String() string {
+	if r.Digest != "" {
+		return fmt.Sprintf("%s%s/%s@%s", Scheme, r.Host, r.Repository, r.Digest)
+	}
+	return fmt.Sprintf("%s%s/%s:%s", Scheme, r.Host, r.Repository, r.Tag)
+}
+
+// scheme returns the URL scheme used to reach the registry.
+// Loopback registries are reached over plain http.
+func (r *Reference) scheme() string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return "http"
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return "http"
+	}
+	return "https"
+}
+
+// hostname returns the registry host without port.
+func (r *Reference) hostname() string {
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		return h
+	}
+	return r.Host
+}
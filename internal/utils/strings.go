@@ -0,0 +1,11 @@
+package utils
+
+import "strings"
+
+// Cut slices s around the first instance of sep, like strings.Cut of Go 1.18.
+func Cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
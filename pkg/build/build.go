@@ -16,56 +16,348 @@ limitations under the License.
 package build
 
 import (
+	gocontext "context"
 	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/errors"
 	"cuelang.org/go/cue/load"
+	"cuelang.org/go/cue/parser"
+	"cuelang.org/go/cue/token"
 	"github.com/loft-orbital/cuebe/pkg/context"
 	"github.com/loft-orbital/cuebe/pkg/injector"
+	"github.com/loft-orbital/cuebe/pkg/log"
+	"github.com/loft-orbital/cuebe/pkg/sensitive"
 	"github.com/loft-orbital/cuebe/pkg/unifier"
-	"github.com/spf13/afero"
 )
 
+// Options configures a Build.
+type Options struct {
+	// Load is the CUE load configuration.
+	// Its Dir and Overlay are overwritten to load the context.
+	Load *load.Config
+	// Cluster returns the cluster k8s injections read from.
+	Cluster injector.ClusterFunc
+	// Injectors provides the available injection types.
+	// Defaults to injector.DefaultRegistry.
+	Injectors *injector.Registry
+	// Sensitive, if set, collects the paths of the sensitive values of the build.
+	Sensitive *sensitive.Paths
+	// Context bounds the requests and commands of http, k8s and exec injections.
+	// Its logger receives the duration of every injection, at debug level.
+	// Defaults to context.Background().
+	Context gocontext.Context
+	// AllowExec lists the executables exec injections may run.
+	AllowExec []string
+	// Workers is the number of injections prepared concurrently.
+	// Defaults to injector.DefaultWorkers.
+	Workers int
+}
+
 // Build builds a context into a single cue.Value,
 // performing all `cuebe` flavored features.
 func Build(bctx *context.Context, cfg *load.Config) (cue.Value, error) {
-	// NOTE: this local copy is done until cue itself support loading from a fs.FS.
-	// c.f. https://github.com/cue-lang/cue/issues/607
-	tempdir, err := afero.TempDir(afero.NewOsFs(), "", "cuebe-build-")
+	return BuildWith(bctx, Options{Load: cfg})
+}
+
+// BuildWith builds a context into a single cue.Value, with the given options.
+func BuildWith(bctx *context.Context, opts Options) (cue.Value, error) {
+	// cue merges overlays with the actual filesystem,
+	// the context is loaded from an empty directory of our own so that no real file leaks in
+	root, err := os.MkdirTemp("", "cuebe-context-")
 	if err != nil {
-		return cue.Value{}, fmt.Errorf("could not create temp directory: %w", err)
+		return cue.Value{}, fmt.Errorf("could not create context root: %w", err)
 	}
-	tempfs := afero.NewBasePathFs(afero.NewOsFs(), tempdir)
-	defer tempfs.RemoveAll("")
-	if err := context.Copy(tempfs, bctx.GetAferoFS()); err != nil {
-		return cue.Value{}, fmt.Errorf("could not copy context to temp directory: %w", err)
+	defer os.RemoveAll(root)
+
+	overlay, err := Overlay(bctx.GetFS(), root)
+	if err != nil {
+		return cue.Value{}, fmt.Errorf("could not read context: %w", err)
 	}
 
-	// overwrite load config
+	// overwrite load config, the module root being set to not look for a cue.mod in the parent directories
+	cfg := opts.Load
 	if cfg == nil {
 		cfg = new(load.Config)
 	}
-	cfg.Dir = tempdir
+	cfg.Dir = root
+	cfg.ModuleRoot = root
+	cfg.Overlay = overlay
 
-	// load context
-	u, err := unifier.Load([]string{}, cfg)
+	// documents read from the standard input may not belong to any package,
+	// they are unified with the context instead
+	docs, err := stdinDocuments(bctx)
 	if err != nil {
+		return cue.Value{}, err
+	}
+	for _, d := range docs {
+		delete(overlay, filepath.Join(root, filepath.FromSlash(d)))
+	}
+	// so are encrypted files and overrides, that cue/load ignores
+	files, err := unifiedFiles(bctx)
+	if err != nil {
+		return cue.Value{}, err
+	}
+
+	// load context
+	var u *unifier.Unifier
+	if len(docs)+len(files) > 0 && !hasRootFiles(overlay, root) {
+		u = unifier.New()
+	} else if u, err = unifier.Load([]string{}, cfg); err != nil {
 		return cue.Value{}, fmt.Errorf("failed to load context: %w", err)
 	}
+	// documents are read through the cache of the injections, so that files are decrypted once
+	cache := injector.NewFileCache()
+	if err := addDocuments(u, docs, bctx, cache, opts.Sensitive); err != nil {
+		return cue.Value{}, err
+	}
+	// encrypted files read by file injections are injection sources, not overrides
+	files = excludeSources(files, injector.FileSources(u.Unify()))
+	if err := addDocuments(u, files, bctx, cache, opts.Sensitive); err != nil {
+		return cue.Value{}, err
+	}
 	v := u.Unify()
 
 	// do injections
-	v = injector.Inject(v, bctx.GetFS())
+	var logger log.Logger = log.DiscardLogger
+	if opts.Context != nil {
+		logger = log.GetLogger(opts.Context)
+	}
+	v = injector.InjectWith(v, injector.Options{
+		FS:        bctx.GetFS(),
+		Cluster:   opts.Cluster,
+		Registry:  opts.Injectors,
+		Sensitive: opts.Sensitive,
+		Context:   opts.Context,
+		AllowExec: opts.AllowExec,
+		FileCache: cache,
+		Workers:   opts.Workers,
+		Logger:    logger,
+	})
 
 	if v.Err() != nil {
 		w := &strings.Builder{}
-		errors.Print(w, v.Err(), &errors.Config{
-			Cwd: tempdir,
+		errors.Print(w, redactErrors(v.Err(), opts.Sensitive), &errors.Config{
+			Cwd: root,
 		})
 		return v, errors.New(w.String())
 	}
 
 	return v, v.Err()
 }
+
+// Overlay returns the CUE files of fsys as a load.Config overlay,
+// as if fsys was located in the dir directory.
+func Overlay(fsys fs.FS, dir string) (map[string]load.Source, error) {
+	overlay := make(map[string]load.Source)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// encrypted CUE files can't be loaded as is
+		if d.IsDir() || path.Ext(name) != ".cue" || unifier.IsEncrypted(name) {
+			return nil
+		}
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return fmt.Errorf("could not read %s: %w", name, err)
+		}
+		overlay[filepath.Join(dir, filepath.FromSlash(name))] = load.FromBytes(b)
+		return nil
+	})
+	return overlay, err
+}
+
+// stdinDocuments returns the document read from the standard input, if it is not part of a CUE package.
+func stdinDocuments(bctx *context.Context) ([]string, error) {
+	name := bctx.Stdin()
+	if name == "" {
+		return nil, nil
+	}
+	if !isDocument(name) {
+		return nil, nil
+	}
+	if path.Ext(name) != ".cue" {
+		return []string{name}, nil
+	}
+
+	b, err := fs.ReadFile(bctx.GetFS(), name)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", name, err)
+	}
+	f, err := parser.ParseFile(name, b, parser.PackageClauseOnly)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", name, err)
+	}
+	if f.PackageName() != "" {
+		return nil, nil
+	}
+	return []string{name}, nil
+}
+
+// addDocuments parses the docs of bctx, read through cache, and adds them to u.
+// The values of encrypted documents are marked as sensitive.
+func addDocuments(u *unifier.Unifier, docs []string, bctx *context.Context, cache *injector.FileCache, sens *sensitive.Paths) error {
+	for _, d := range docs {
+		b, err := cache.ReadFile(d, bctx.GetFS())
+		if err != nil {
+			return fmt.Errorf("failed to load context: failed to add %s: %w", d, err)
+		}
+		dv, err := u.Parse(d, b)
+		if err != nil {
+			return fmt.Errorf("failed to load context: %w", err)
+		}
+		if unifier.IsEncrypted(d) {
+			sens.Add(leafPaths(dv)...)
+		}
+		u.Add(dv)
+	}
+	return nil
+}
+
+// excludeSources returns the files that are not encrypted files matching one of the srcs
+// file injection sources, a file name, a directory or a glob pattern.
+func excludeSources(files, srcs []string) []string {
+	var kept []string
+	for _, f := range files {
+		if !unifier.IsEncrypted(f) || !isSource(f, srcs) {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// isSource reports whether one of the srcs file injection sources reads name.
+func isSource(name string, srcs []string) bool {
+	for _, src := range srcs {
+		src = path.Clean(src)
+		if src == name || src == path.Dir(name) {
+			return true
+		}
+		if ok, _ := path.Match(src, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// unifiedFiles returns the files of a context to unify with its root instance:
+// the encrypted CUE, JSON and YAML files at its root, then the JSON and YAML overrides
+// mounted at its root.
+// Only the root is searched: files in sub-directories, mounted ones included,
+// are left to injections, since unifying them at the root would not match their location.
+func unifiedFiles(bctx *context.Context) ([]string, error) {
+	entries, err := fs.ReadDir(bctx.GetFS(), ".")
+	if err != nil {
+		return nil, fmt.Errorf("could not read context: %w", err)
+	}
+	var files []string
+	// the standard input is unified on its own
+	seen := map[string]bool{bctx.Stdin(): true}
+	for _, e := range entries {
+		if !e.IsDir() && unifier.IsEncrypted(e.Name()) && isDocument(e.Name()) {
+			files = append(files, e.Name())
+			seen[e.Name()] = true
+		}
+	}
+	for _, o := range bctx.Overrides() {
+		// plain CUE files are loaded with the root instance
+		if path.Dir(o) != "." || path.Ext(o) == ".cue" || !isDocument(o) || seen[o] {
+			continue
+		}
+		files = append(files, o)
+		seen[o] = true
+	}
+	return files, nil
+}
+
+// isDocument reports whether name is a CUE, JSON or YAML document.
+func isDocument(name string) bool {
+	switch path.Ext(name) {
+	case ".cue", ".json", ".yaml", ".yml":
+		return true
+	default:
+		return false
+	}
+}
+
+// leafPaths returns the paths of the fields of v that are not structs.
+func leafPaths(v cue.Value) []cue.Path {
+	var paths []cue.Path
+	v.Walk(func(v cue.Value) bool {
+		if v.IncompleteKind() == cue.StructKind {
+			return true
+		}
+		paths = append(paths, v.Path())
+		return false
+	}, nil)
+	return paths
+}
+
+// hasRootFiles reports whether an overlay has CUE files at the context root.
+func hasRootFiles(overlay map[string]load.Source, root string) bool {
+	for name := range overlay {
+		if filepath.Dir(name) == root {
+			return true
+		}
+	}
+	return false
+}
+
+// redactErrors hides the values from the errors of sensitive fields,
+// such as conflicting values.
+func redactErrors(err error, sens *sensitive.Paths) error {
+	var res errors.Error
+	for _, e := range errors.Errors(err) {
+		if sens.Contains(errorPath(e)) {
+			e = redactedError{e}
+		}
+		res = errors.Append(res, e)
+	}
+	return res
+}
+
+// errorPath returns the path of the field an error is about.
+func errorPath(err errors.Error) cue.Path {
+	var sels []cue.Selector
+	for _, l := range err.Path() {
+		if i, aerr := strconv.Atoi(l); aerr == nil {
+			sels = append(sels, cue.Index(i))
+			continue
+		}
+		p := cue.ParsePath(l)
+		if p.Err() != nil {
+			return p
+		}
+		sels = append(sels, p.Selectors()...)
+	}
+	return cue.MakePath(sels...)
+}
+
+// redactedError is an error whose message arguments are redacted.
+type redactedError struct {
+	err errors.Error
+}
+
+func (e redactedError) Position() token.Pos         { return e.err.Position() }
+func (e redactedError) InputPositions() []token.Pos { return e.err.InputPositions() }
+func (e redactedError) Path() []string              { return e.err.Path() }
+
+func (e redactedError) Msg() (string, []interface{}) {
+	format, args := e.err.Msg()
+	redacted := make([]interface{}, len(args))
+	for i := range redacted {
+		redacted[i] = sensitive.Redacted
+	}
+	return format, redacted
+}
+
+func (e redactedError) Error() string {
+	return errors.String(e)
+}
@@ -1,12 +1,25 @@
 package build
 
 import (
+	gocontext "context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/load"
+	"github.com/loft-orbital/cuebe/internal/utils"
 	"github.com/loft-orbital/cuebe/pkg/context"
+	"github.com/loft-orbital/cuebe/pkg/injector"
+	"github.com/loft-orbital/cuebe/pkg/sensitive"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dfake "k8s.io/client-go/dynamic/fake"
 )
 
 func TestTestBuild(t *testing.T) {
@@ -34,3 +47,275 @@ func TestTestBuild(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "conflicting values 42 and string")
 }
+
+func TestBuildModule(t *testing.T) {
+	bctx := context.New()
+	fsys := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fsys, "cue.mod/module.cue", []byte(`module: "example.com/app"`), 0666))
+	require.NoError(t, afero.WriteFile(fsys, "cue.mod/pkg/example.com/lib/lib.cue", []byte("package lib\nname: \"lib\""), 0666))
+	require.NoError(t, afero.WriteFile(fsys, "main.cue", []byte("package main\nimport \"example.com/lib\"\nhello: lib.name"), 0666))
+	require.NoError(t, bctx.Add(fsys))
+
+	v, err := Build(bctx, nil)
+	require.NoError(t, err)
+	name, err := v.LookupPath(cue.ParsePath("hello")).String()
+	assert.NoError(t, err)
+	assert.Equal(t, "lib", name)
+
+	// errors are reported relative to the context
+	require.NoError(t, afero.WriteFile(fsys, "error.cue", []byte("package main\nhello: 42"), 0666))
+	require.NoError(t, bctx.Add(fsys))
+	_, err = Build(bctx, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "./error.cue:2:8")
+	assert.NotContains(t, err.Error(), "cuebe-context-")
+}
+
+func TestBuildHostFiles(t *testing.T) {
+	// real files around the directory the context is loaded from are left out
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	require.NoError(t, os.MkdirAll(filepath.Join(tmp, "cue.mod"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "cue.mod", "module.cue"), []byte("not: valid: cue: {"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "leak.cue"), []byte("package main\nleak: true"), 0644))
+
+	bctx := context.New()
+	fsys := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fsys, "main.cue", []byte("package main\nhello: \"cuebe\""), 0666))
+	require.NoError(t, bctx.Add(fsys))
+
+	v, err := Build(bctx, nil)
+	require.NoError(t, err)
+	actual, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"hello": "cuebe"}`, string(actual))
+
+	// and the directory is removed once built
+	entries, err := os.ReadDir(tmp)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestBuildStdin(t *testing.T) {
+	// alone
+	bctx, err := context.FromArgs(gocontext.Background(), []string{context.StdinArg}, &context.Options{
+		Stdin: strings.NewReader("hello: cuebe"),
+	})
+	require.NoError(t, err)
+
+	v, err := Build(bctx, nil)
+	require.NoError(t, err)
+	name, err := v.LookupPath(cue.ParsePath("hello")).String()
+	assert.NoError(t, err)
+	assert.Equal(t, "cuebe", name)
+
+	// unified with a package
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.cue"), []byte("package main\nhello: string"), 0644))
+	bctx, err = context.FromArgs(gocontext.Background(), []string{dir, context.StdinArg}, &context.Options{
+		Stdin: strings.NewReader(`hello: "stdin"`),
+	})
+	require.NoError(t, err)
+
+	v, err = Build(bctx, nil)
+	require.NoError(t, err)
+	name, err = v.LookupPath(cue.ParsePath("hello")).String()
+	assert.NoError(t, err)
+	assert.Equal(t, "stdin", name)
+
+	// mounted under another name
+	bctx, err = context.FromArgs(gocontext.Background(), []string{dir, context.StdinArg + ":values.yaml"}, &context.Options{
+		Stdin: strings.NewReader("hello: values"),
+	})
+	require.NoError(t, err)
+
+	v, err = Build(bctx, nil)
+	require.NoError(t, err)
+	name, err = v.LookupPath(cue.ParsePath("hello")).String()
+	assert.NoError(t, err)
+	assert.Equal(t, "values", name)
+
+	// part of the package
+	bctx, err = context.FromArgs(gocontext.Background(), []string{dir, context.StdinArg}, &context.Options{
+		Stdin: strings.NewReader("package main\nhello: \"pkg\""),
+	})
+	require.NoError(t, err)
+
+	v, err = Build(bctx, nil)
+	require.NoError(t, err)
+	name, err = v.LookupPath(cue.ParsePath("hello")).String()
+	assert.NoError(t, err)
+	assert.Equal(t, "pkg", name)
+
+	// files named after the standard input are regular files
+	require.NoError(t, os.WriteFile(filepath.Join(dir, context.StdinYAML), []byte("hello: 42"), 0644))
+	bctx, err = context.FromArgs(gocontext.Background(), []string{dir}, nil)
+	require.NoError(t, err)
+
+	_, err = Build(bctx, nil)
+	require.NoError(t, err)
+}
+
+func TestBuildOptions(t *testing.T) {
+	bctx := context.New()
+	fsys := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fsys, "main.cue", []byte(`package main
+env: *"dev" | string @tag(env)
+password: string @inject(type=k8s, kind=Secret, namespace=prod, name=db, key=password)`), 0666))
+	require.NoError(t, bctx.Add(fsys))
+
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "db", "namespace": "prod"},
+		"data":       map[string]interface{}{"password": "czNjcjN0"},
+	}}
+	client := dfake.NewSimpleDynamicClient(runtime.NewScheme(), secret)
+
+	v, err := BuildWith(bctx, Options{
+		Load: &load.Config{Tags: []string{"env=prod"}},
+		Cluster: func() (*utils.K8sConfig, error) {
+			return &utils.K8sConfig{DynamicClient: client}, nil
+		},
+	})
+	require.NoError(t, err)
+	actual, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"env":"prod","password":"s3cr3t"}`, string(actual))
+
+	// without cluster
+	_, err = Build(bctx, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no cluster configured")
+}
+
+func TestBuildInjectors(t *testing.T) {
+	bctx := context.New()
+	fsys := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fsys, "main.cue", []byte("package main\nhello: string @inject(type=greeting)"), 0666))
+	require.NoError(t, bctx.Add(fsys))
+
+	_, err := Build(bctx, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported injector type greeting")
+
+	r := injector.NewRegistry()
+	r.Register("greeting", func(attr *cue.Attribute, dst cue.Path, s *injector.Session) injector.Injector {
+		return injector.NewEnv("CUEBE_GREETING", dst)
+	})
+	t.Setenv("CUEBE_GREETING", "cuebe")
+	v, err := BuildWith(bctx, Options{Injectors: r})
+	require.NoError(t, err)
+	name, err := v.LookupPath(cue.ParsePath("hello")).String()
+	assert.NoError(t, err)
+	assert.Equal(t, "cuebe", name)
+}
+
+func TestBuildSensitive(t *testing.T) {
+	bctx := context.New()
+	fsys := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fsys, "main.cue", []byte("package main\ntoken: string @inject(type=env, name=CUEBE_TOKEN, sensitive=true)"), 0666))
+	require.NoError(t, bctx.Add(fsys))
+
+	t.Setenv("CUEBE_TOKEN", "s3cr3t")
+	sens := sensitive.NewPaths()
+	v, err := BuildWith(bctx, Options{Sensitive: sens})
+	require.NoError(t, err)
+	assert.Equal(t, []cue.Path{cue.ParsePath("token")}, sens.List())
+	assert.Equal(t, []string{"s3cr3t"}, sens.Values(v))
+}
+
+func TestBuildSensitiveError(t *testing.T) {
+	bctx := context.New()
+	fsys := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fsys, "main.cue", []byte(`package main
+token: string @inject(type=env, name=CUEBE_TOKEN, sensitive=true)
+token: "other"
+`), 0666))
+	require.NoError(t, bctx.Add(fsys))
+
+	t.Setenv("CUEBE_TOKEN", "s3cr3t")
+	_, err := BuildWith(bctx, Options{Sensitive: sensitive.NewPaths()})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "token: conflicting values <redacted> and <redacted>")
+	assert.NotContains(t, err.Error(), "s3cr3t")
+}
+
+func TestBuildEncrypted(t *testing.T) {
+	bctx := context.New()
+	fsys := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fsys, "main.cue", []byte("package main\nreplicas: int"), 0666))
+	// injection sources are not unified
+	require.NoError(t, afero.WriteFile(fsys, "secrets/db.enc.yaml", []byte("password: hunter2"), 0666))
+	require.NoError(t, bctx.Add(fsys))
+	_, err := Build(bctx, nil)
+	assert.NoError(t, err)
+
+	// root encrypted files are decrypted, CUE ones included
+	for _, name := range []string{"main.enc.yaml", "main.enc.cue"} {
+		bctx := context.New()
+		require.NoError(t, afero.WriteFile(fsys, name, []byte("{not: decrypted"), 0666))
+		require.NoError(t, bctx.Add(fsys))
+		require.NoError(t, fsys.Remove(name))
+
+		_, err := Build(bctx, nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to add "+name+": could not decrypt data")
+	}
+
+	// root encrypted files read by file injections are injected, not unified
+	bctx = context.New()
+	require.NoError(t, afero.WriteFile(fsys, "main.cue", []byte("package main\npassword: string @inject(type=file, src=db.enc.yaml, path=$.password)"), 0666))
+	require.NoError(t, afero.WriteFile(fsys, "db.enc.yaml", []byte("{not: decrypted"), 0666))
+	require.NoError(t, bctx.Add(fsys))
+	_, err = Build(bctx, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read db.enc.yaml: could not decrypt data")
+	assert.NotContains(t, err.Error(), "failed to add")
+}
+
+func TestIsSource(t *testing.T) {
+	srcs := []string{"db.enc.yaml", "secrets/", "*.enc.json"}
+	assert.True(t, isSource("db.enc.yaml", srcs))
+	assert.True(t, isSource("secrets/api.enc.yaml", srcs))
+	assert.True(t, isSource("main.enc.json", srcs))
+	assert.False(t, isSource("main.enc.yaml", srcs))
+	assert.True(t, isSource("main.enc.yaml", []string{"."}))
+}
+
+func TestBuildOverrides(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.cue"), []byte("package main\nreplicas: int\nname: *\"app\" | string"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "values.yaml"), []byte("replicas: 3"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "ca.crt"), []byte("certificate"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.json"), []byte(`{"name": "other"}`), 0644))
+
+	bctx, err := context.FromArgs(gocontext.Background(), []string{
+		filepath.Join(dir, "main.cue"),
+		filepath.Join(dir, "values.yaml"),
+		// mounted elsewhere, not an override
+		filepath.Join(dir, "ca.crt") + ":certs/",
+		filepath.Join(dir, "other.json") + ":config/",
+	}, nil)
+	require.NoError(t, err)
+
+	v, err := Build(bctx, nil)
+	require.NoError(t, err)
+	actual, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"replicas": 3, "name": "app"}`, string(actual))
+}
+
+func TestLeafPaths(t *testing.T) {
+	v := cuecontext.New().CompileString(`
+db: {user: "admin", password: "hunter2"}
+hosts: ["a", "b"]
+port: 5432
+`)
+	assert.Equal(t, []cue.Path{
+		cue.ParsePath("db.user"),
+		cue.ParsePath("db.password"),
+		cue.ParsePath("hosts"),
+		cue.ParsePath("port"),
+	}, leafPaths(v))
+}
@@ -1,40 +1,205 @@
 package context
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	gocontext "context"
+	"errors"
 	"fmt"
 	"io"
 	iofs "io/fs"
 	"os"
 	"path"
+	"path/filepath"
 
+	"github.com/loft-orbital/cuebe/internal/oci"
+	"github.com/loft-orbital/cuebe/pkg/cube"
+	"github.com/loft-orbital/cuebe/pkg/log"
 	"github.com/spf13/afero"
 )
 
+// Context is a filesystem merged from one or several layers.
 type Context struct {
 	fs afero.Fs
+	// origins tracks the layers each file comes from.
+	origins map[string][]string
+	layers  int
+	// overrides are the single files added from arguments, in order.
+	overrides []string
+	// stdin is the document read from the standard input, if any.
+	stdin string
+
+	// OnConflict is the strategy applied when a layer overrides a file with a different content.
+	// Defaults to OnConflictOverride.
+	OnConflict ConflictStrategy
+	// Logger receives conflict warnings.
+	Logger log.Logger
 }
 
 func New() *Context {
-	return &Context{fs: afero.NewMemMapFs()}
+	return &Context{
+		fs:      afero.NewMemMapFs(),
+		origins: make(map[string][]string),
+	}
 }
 
-func FromArgs(args []string) (*Context, error) {
-	ctx := New()
+// Options configures how FromArgs builds a Context.
+type Options struct {
+	// OnConflict is the strategy applied when an argument overrides a file with a different content.
+	OnConflict ConflictStrategy
+	// PublicKey, when set, requires every cube argument to be signed with its private key.
+	PublicKey ed25519.PublicKey
+	// Stdin is read when an argument is StdinArg.
+	Stdin io.Reader
+}
+
+// FromArgs builds a Context merging every argument, in order.
+// An argument can be a local directory, a cube (tar.gz archive),
+// an HTTP(S) url pointing to a cube or a single file, a git repository,
+// a cube stored in an OCI registry or StdinArg, reading opts.Stdin.
+// The standard input can only be used once.
+// Conflict warnings are sent to the ctx logger.
+//
+// Local paths and StdinArg can be mounted at a sub-path of the Context with the src:dst syntax.
+// A single file is renamed after dst, unless dst ends with a slash,
+// anything else is mounted under the dst directory.
+//
+// If opts.PublicKey is set, cubes must have a valid detached signature
+// (the cube location suffixed with cube.SignatureExt, or pushed along an OCI cube)
+// and remote arguments must be such cubes.
+// Local directories and plain files are accepted as is.
+func FromArgs(ctx gocontext.Context, args []string, opts *Options) (*Context, error) {
+	if opts == nil {
+		opts = new(Options)
+	}
+	c := New()
+	c.OnConflict = opts.OnConflict
+	c.Logger = log.GetLogger(ctx)
 
+	stdin := false
 	for _, arg := range args {
-		if !path.IsAbs(arg) {
-			cwd, err := os.Getwd()
-			if err != nil {
-				return nil, fmt.Errorf("could not get working directory: %w", err)
-			}
-			arg = path.Join(cwd, arg)
+		src, dst, err := SplitMount(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		var fs afero.Fs
+		switch {
+		case src == StdinArg && stdin:
+			return nil, errors.New("standard input can only be used once")
+		case src == StdinArg && opts.PublicKey != nil:
+			err = errors.New("signature required: standard input cannot be verified")
+		case src == StdinArg:
+			stdin = true
+			fs, err = stdinFS(opts.Stdin)
+		case opts.PublicKey != nil:
+			fs, err = signedFS(ctx, src, opts.PublicKey)
+		default:
+			fs, err = fsFromArg(ctx, src)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not load %s: %w", src, err)
+		}
+
+		fs, dir, err := mount(fs, dst)
+		if err != nil {
+			return nil, fmt.Errorf("could not mount %s: %w", arg, err)
 		}
-		if err := ctx.Add(afero.NewBasePathFs(afero.NewOsFs(), arg)); err != nil {
+		if err := c.AddLayerAt(arg, fs, dir); err != nil {
 			return nil, fmt.Errorf("could not add %s to context: %w", arg, err)
 		}
+		if sf, ok := fs.(*singleFile); ok {
+			if src == StdinArg {
+				c.stdin = path.Join(dir, sf.name)
+			} else {
+				c.addOverride(path.Join(dir, sf.name))
+			}
+		}
 	}
 
-	return ctx, nil
+	return c, nil
+}
+
+// fsFromArg returns the filesystem an argument refers to.
+func fsFromArg(ctx gocontext.Context, arg string) (afero.Fs, error) {
+	switch {
+	case IsGit(arg):
+		return gitFS(ctx, arg)
+	case IsHTTP(arg):
+		return httpFS(ctx, arg)
+	case oci.IsReference(arg):
+		return ociFS(ctx, arg)
+	}
+
+	name, err := absPath(arg)
+	if err != nil {
+		return nil, err
+	}
+	return localFS(name)
+}
+
+// absPath returns the absolute path of a local argument.
+func absPath(arg string) (string, error) {
+	if path.IsAbs(arg) {
+		return arg, nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("could not get working directory: %w", err)
+	}
+	return path.Join(cwd, arg), nil
+}
+
+// ociFS returns the filesystem of a cube stored in an OCI registry.
+func ociFS(ctx gocontext.Context, arg string) (afero.Fs, error) {
+	ref, err := oci.ParseReference(arg)
+	if err != nil {
+		return nil, err
+	}
+	data, err := oci.Pull(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("could not pull %s: %w", ref, err)
+	}
+
+	fs := afero.NewMemMapFs()
+	if err := cube.Unpack(fs, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("could not unpack cube: %w", err)
+	}
+	return fs, nil
+}
+
+// localFS returns the filesystem of a local argument.
+// Directories are used as a base path, cubes are unpacked in memory
+// and any other file is the only file of its filesystem.
+func localFS(name string) (afero.Fs, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return afero.NewBasePathFs(afero.NewOsFs(), name), nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	if !cube.IsCube(r) {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return newSingleFile(path.Base(name), data)
+	}
+
+	fs := afero.NewMemMapFs()
+	if err := cube.Unpack(fs, r); err != nil {
+		return nil, fmt.Errorf("could not unpack cube: %w", err)
+	}
+	return fs, nil
 }
 
 // GetFS returns the standard fs.FS underlying filesystem.
@@ -48,18 +213,98 @@ func (c *Context) GetAferoFS() afero.Fs {
 	return afero.NewReadOnlyFs(c.fs)
 }
 
-// Add copies the content of fs into this Context.
+// Add copies the content of fs into this Context, as an anonymous layer.
 // The content of fs takes priority if there is a conflict.
+// Files matching .cuebeignore directives are left out.
 func (c *Context) Add(fs afero.Fs) error {
-	return Copy(c.fs, fs)
+	return c.AddLayer(fmt.Sprintf("#%d", c.layers+1), fs)
+}
+
+// AddLayer copies the content of fs into this Context, recording name as its origin.
+// The content of fs takes priority if there is a conflict, unless OnConflict says otherwise.
+// Files matching .cuebeignore directives are left out.
+func (c *Context) AddLayer(name string, fs afero.Fs) error {
+	return c.AddLayerAt(name, fs, "")
+}
+
+// AddLayerAt is like AddLayer, but copies the content of fs under the dir directory of this Context.
+func (c *Context) AddLayerAt(name string, fs afero.Fs, dir string) error {
+	c.layers++
+	dst := c.fs
+	if dir != "" {
+		if err := c.fs.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("could not create %s: %w", dir, err)
+		}
+		dst = afero.NewBasePathFs(c.fs, dir)
+	}
+
+	ignorer := newIgnorer(fs)
+	return copyFiltered(dst, fs, func(p string, info iofs.FileInfo) (bool, error) {
+		skip, err := ignorer.Ignore(p, info)
+		if err != nil || skip || p == "" || info.IsDir() {
+			return skip, err
+		}
+		return false, c.track(name, fs, p, path.Join(dir, filepath.ToSlash(p)))
+	})
+}
+
+// Overrides returns the paths of the single files given as arguments, such as main.enc.yaml,
+// in argument order, wherever they are mounted and whatever their format.
+// It is up to the caller to pick the ones it unifies: a build only unifies the JSON and YAML files
+// mounted at the root, CUE files being loaded with their package and the others left to injections.
+// The standard input is not part of them.
+func (c *Context) Overrides() []string {
+	return append([]string(nil), c.overrides...)
+}
+
+// addOverride records name as the last override.
+func (c *Context) addOverride(name string) {
+	for i, o := range c.overrides {
+		if o == name {
+			c.overrides = append(c.overrides[:i], c.overrides[i+1:]...)
+			break
+		}
+	}
+	c.overrides = append(c.overrides, name)
+}
+
+// Stdin returns the path of the single document read from the standard input,
+// StdinCUE, StdinYAML or the name it is mounted as. It is empty if the standard input
+// was not used, or was an archive.
+func (c *Context) Stdin() string {
+	return c.stdin
+}
+
+func (c *Context) logger() log.Logger {
+	if c.Logger == nil {
+		return log.DiscardLogger
+	}
+	return c.Logger
 }
 
 // Copy copies src afero.Fs into dst.
 func Copy(dst, src afero.Fs) error {
+	return copyFiltered(dst, src, nil)
+}
+
+// copyFiltered copies src afero.Fs into dst, skipping files for which skip returns true.
+func copyFiltered(dst, src afero.Fs, skip func(path string, info iofs.FileInfo) (bool, error)) error {
 	return afero.Walk(src, "", func(path string, info iofs.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if skip != nil {
+			skipped, err := skip(path, info)
+			if err != nil {
+				return err
+			}
+			if skipped {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
 		if path == "" {
 			return nil
 		}
@@ -88,7 +333,7 @@ func CopyFile(dst, src afero.Fs, name string, stat iofs.FileMode) (int64, error)
 	}
 	defer srcF.Close()
 
-	dstF, err := dst.OpenFile(name, os.O_RDWR|os.O_CREATE, stat)
+	dstF, err := dst.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, stat)
 	if err != nil {
 		return 0, fmt.Errorf("could not create file: %w", err)
 	}
@@ -1,10 +1,19 @@
 package context
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
 	iofs "io/fs"
 	"io/ioutil"
+	"os"
+	"path"
+	"runtime"
 	"testing"
 
+	"github.com/loft-orbital/cuebe/pkg/cube"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -77,3 +86,166 @@ func TestCopy(t *testing.T) {
 	assert.False(t, stat.IsDir(), "'cue.mod/module.cue' should be a file")
 	assert.Equal(t, len([]byte("module: \"github.com/super/module\"")), int(stat.Size()))
 }
+
+func TestFromArgs(t *testing.T) {
+	if runtime.GOOS == "windows" && os.Getenv("CI") != "" {
+		t.Skip("skipping fs related test on windows")
+	}
+
+	// directory
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(dir, "main.cue"), []byte("package main"), 0644))
+	require.NoError(t, os.WriteFile(path.Join(dir, "override.cue"), []byte("package base"), 0644))
+
+	// cube
+	buf := new(bytes.Buffer)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "override.cue", Typeflag: tar.TypeReg, Mode: 0644, Size: 12}))
+	_, err := tw.Write([]byte("package cube"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	cube := path.Join(t.TempDir(), "cube.tar.gz")
+	require.NoError(t, os.WriteFile(cube, buf.Bytes(), 0644))
+
+	ctx, err := FromArgs(context.Background(), []string{dir, cube}, nil)
+	require.NoError(t, err)
+	b, err := afero.ReadFile(ctx.GetAferoFS(), "main.cue")
+	assert.NoError(t, err)
+	assert.Equal(t, "package main", string(b))
+	b, err = afero.ReadFile(ctx.GetAferoFS(), "override.cue")
+	assert.NoError(t, err)
+	assert.Equal(t, "package cube", string(b))
+	assert.Empty(t, ctx.Overrides())
+
+	// single files
+	require.NoError(t, os.WriteFile(path.Join(dir, "main.enc.yaml"), []byte("foo: bar"), 0644))
+	values := path.Join(t.TempDir(), "values.yaml")
+	require.NoError(t, os.WriteFile(values, []byte("replicas: 2"), 0644))
+	ctx, err = FromArgs(context.Background(), []string{dir, values + ":env/", path.Join(dir, "main.enc.yaml"), values + ":env/"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"main.enc.yaml", "env/values.yaml"}, ctx.Overrides())
+
+	// missing argument
+	_, err = FromArgs(context.Background(), []string{path.Join(dir, "missing")}, nil)
+	assert.Error(t, err)
+
+	// invalid oci reference
+	_, err = FromArgs(context.Background(), []string{"oci://registry"}, nil)
+	assert.ErrorContains(t, err, "missing repository")
+}
+
+func TestContextAddIgnore(t *testing.T) {
+	src := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(src, ".cuebeignore", []byte("# comment\n.git/\n*.swp\nfixtures/\n!keep.swp\n"), 0666))
+	require.NoError(t, afero.WriteFile(src, ".git/HEAD", []byte("ref: refs/heads/main"), 0666))
+	require.NoError(t, afero.WriteFile(src, "main.cue", []byte("package main"), 0666))
+	require.NoError(t, afero.WriteFile(src, ".main.cue.swp", []byte("swap"), 0666))
+	require.NoError(t, afero.WriteFile(src, "keep.swp", []byte("swap"), 0666))
+	require.NoError(t, afero.WriteFile(src, "fixtures/big.json", []byte("{}"), 0666))
+	require.NoError(t, afero.WriteFile(src, "dir/.cuebeignore", []byte("*.yaml\n"), 0666))
+	require.NoError(t, afero.WriteFile(src, "dir/values.yaml", []byte("foo: bar"), 0666))
+	require.NoError(t, afero.WriteFile(src, "dir/nested/values.yaml", []byte("foo: bar"), 0666))
+	require.NoError(t, afero.WriteFile(src, "values.yaml", []byte("foo: bar"), 0666))
+
+	ctx := New()
+	require.NoError(t, ctx.Add(src))
+	fs := ctx.GetAferoFS()
+
+	for _, name := range []string{"main.cue", "keep.swp", "values.yaml", ".cuebeignore", "dir/.cuebeignore"} {
+		_, err := fs.Stat(name)
+		assert.NoError(t, err, "%s should be in context", name)
+	}
+	for _, name := range []string{".git", ".main.cue.swp", "fixtures", "dir/values.yaml", "dir/nested/values.yaml"} {
+		_, err := fs.Stat(name)
+		assert.ErrorIs(t, err, iofs.ErrNotExist, "%s should be ignored", name)
+	}
+}
+
+type recordLogger struct {
+	errors []string
+}
+
+func (l *recordLogger) Info(format string, v ...interface{})  {}
+func (l *recordLogger) Error(format string, v ...interface{}) {
+	l.errors = append(l.errors, fmt.Sprintf(format, v...))
+}
+
+func TestContextAddLayer(t *testing.T) {
+	base := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(base, "main.cue", []byte("package main"), 0666))
+	require.NoError(t, afero.WriteFile(base, "cue.mod/module.cue", []byte("module: \"potato\""), 0666))
+	overlay := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(overlay, "main.cue", []byte("package overlay"), 0666))
+	require.NoError(t, afero.WriteFile(overlay, "cue.mod/module.cue", []byte("module: \"potato\""), 0666))
+	require.NoError(t, afero.WriteFile(overlay, "values.cue", []byte("package main"), 0666))
+
+	// override
+	ctx := New()
+	require.NoError(t, ctx.AddLayer("base", base))
+	require.NoError(t, ctx.AddLayer("overlay", overlay))
+	assert.Equal(t, []File{
+		{Path: "cue.mod/module.cue", Layers: []string{"base", "overlay"}},
+		{Path: "main.cue", Layers: []string{"base", "overlay"}},
+		{Path: "values.cue", Layers: []string{"overlay"}},
+	}, ctx.Files())
+	b, err := afero.ReadFile(ctx.GetAferoFS(), "main.cue")
+	assert.NoError(t, err)
+	assert.Equal(t, "package overlay", string(b))
+
+	// shorter content
+	long := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(long, "main.cue", []byte("package main\nfoo: \"a long value here\""), 0666))
+	short := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(short, "main.cue", []byte("package main"), 0666))
+	ctx = New()
+	require.NoError(t, ctx.AddLayer("long", long))
+	require.NoError(t, ctx.AddLayer("short", short))
+	b, err = afero.ReadFile(ctx.GetAferoFS(), "main.cue")
+	assert.NoError(t, err)
+	assert.Equal(t, "package main", string(b))
+
+	// warn, identical content is not a conflict
+	logger := &recordLogger{}
+	ctx = New()
+	ctx.OnConflict = OnConflictWarn
+	ctx.Logger = logger
+	require.NoError(t, ctx.AddLayer("base", base))
+	require.NoError(t, ctx.AddLayer("overlay", overlay))
+	assert.Equal(t, []string{"warning: main.cue from overlay conflicts with base\n"}, logger.errors)
+
+	// error
+	ctx = New()
+	ctx.OnConflict = OnConflictError
+	require.NoError(t, ctx.AddLayer("base", base))
+	err = ctx.AddLayer("overlay", overlay)
+	var cerr *ConflictError
+	require.ErrorAs(t, err, &cerr)
+	assert.Equal(t, &ConflictError{Path: "main.cue", Layer: "overlay", Previous: "base"}, cerr)
+
+	// cube metadata never conflicts
+	cube1 := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(cube1, cube.MetadataFile, []byte(`{"commit": "a"}`), 0666))
+	cube2 := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(cube2, cube.MetadataFile, []byte(`{"commit": "b"}`), 0666))
+	ctx = New()
+	ctx.OnConflict = OnConflictError
+	require.NoError(t, ctx.AddLayer("cube1", cube1))
+	assert.NoError(t, ctx.AddLayer("cube2", cube2))
+
+	// anonymous layers
+	ctx = New()
+	require.NoError(t, ctx.Add(base))
+	assert.Equal(t, []string{"#1"}, ctx.Files()[0].Layers)
+}
+
+func TestParseConflictStrategy(t *testing.T) {
+	for _, s := range []ConflictStrategy{OnConflictOverride, OnConflictWarn, OnConflictError} {
+		actual, err := ParseConflictStrategy(string(s))
+		assert.NoError(t, err)
+		assert.Equal(t, s, actual)
+	}
+	_, err := ParseConflictStrategy("potato")
+	assert.Error(t, err)
+}
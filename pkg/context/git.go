@@ -0,0 +1,198 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package context
+
+import (
+	gocontext "context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/loft-orbital/cuebe/internal/mod"
+	"github.com/spf13/afero"
+)
+
+const gitPrefix = "git+"
+
+// IsGit returns true if arg points to a git repository context.
+func IsGit(arg string) bool {
+	return strings.HasPrefix(arg, gitPrefix)
+}
+
+// GitSource represents a git repository context.
+type GitSource struct {
+	// URL is the clone url of the repository.
+	URL string
+	// Subdir is the directory of the repository to use as context.
+	Subdir string
+	// Ref is the tag, branch or commit to checkout.
+	// The remote HEAD is used when empty.
+	Ref string
+}
+
+// ParseGit parses a git context argument.
+// The expected format is git+<url>[//<subdir>][?ref=<tag|branch|commit>],
+// e.g. git+https://github.com/org/repo.git//deploy?ref=v1.2.3
+func ParseGit(arg string) (*GitSource, error) {
+	if !IsGit(arg) {
+		return nil, fmt.Errorf("%s is not a git context", arg)
+	}
+	u, err := url.Parse(strings.TrimPrefix(arg, gitPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse url: %w", err)
+	}
+
+	src := &GitSource{Ref: u.Query().Get("ref")}
+	u.RawQuery = ""
+	if i := strings.Index(u.Path, "//"); i >= 0 {
+		src.Subdir = strings.Trim(u.Path[i+2:], "/")
+		u.Path = u.Path[:i]
+		u.RawPath = ""
+	}
+	src.URL = u.String()
+
+	return src, nil
+}
+
+// gitFS returns the filesystem of a git context.
+func gitFS(ctx gocontext.Context, arg string) (afero.Fs, error) {
+	src, err := ParseGit(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	wt, err := src.Clone(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if src.Subdir != "" {
+		if wt, err = wt.Chroot(src.Subdir); err != nil {
+			return nil, fmt.Errorf("could not chroot subdirectory %s: %w", src.Subdir, err)
+		}
+		if _, err := wt.Stat(""); err != nil {
+			return nil, fmt.Errorf("could not find subdirectory %s: %w", src.Subdir, err)
+		}
+	}
+
+	fs := afero.NewMemMapFs()
+	if err := copyBilly(fs, wt, ""); err != nil {
+		return nil, fmt.Errorf("could not copy worktree: %w", err)
+	}
+	return fs, nil
+}
+
+// Clone clones the repository in memory at the source ref and returns its worktree.
+func (s *GitSource) Clone(ctx gocontext.Context) (billy.Filesystem, error) {
+	opts := &gogit.CloneOptions{URL: s.URL, Depth: 1, Tags: gogit.NoTags}
+	ep, err := transport.NewEndpoint(s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository url: %w", err)
+	}
+	if ep.Protocol == "https" || ep.Protocol == "http" {
+		if usr, pwd := mod.CredentialsFor(ep.Host); pwd != "" {
+			opts.Auth = &http.BasicAuth{Username: usr, Password: pwd}
+		}
+	}
+
+	if s.Ref == "" {
+		return clone(ctx, opts)
+	}
+
+	// commits can not be shallow cloned
+	if plumbing.IsHash(s.Ref) {
+		opts.Depth = 0
+		wt := memfs.New()
+		r, err := gogit.CloneContext(ctx, memory.NewStorage(), wt, opts)
+		if err != nil {
+			return nil, fmt.Errorf("could not clone %s: %w", s.URL, err)
+		}
+		w, err := r.Worktree()
+		if err != nil {
+			return nil, fmt.Errorf("could not get worktree: %w", err)
+		}
+		if err := w.Checkout(&gogit.CheckoutOptions{Hash: plumbing.NewHash(s.Ref), Force: true}); err != nil {
+			return nil, fmt.Errorf("could not checkout %s: %w", s.Ref, err)
+		}
+		return wt, nil
+	}
+
+	// try as a tag, then as a branch
+	opts.SingleBranch = true
+	opts.ReferenceName = plumbing.NewTagReferenceName(s.Ref)
+	wt, err := clone(ctx, opts)
+	if !errors.Is(err, gogit.NoMatchingRefSpecError{}) {
+		return wt, err
+	}
+	opts.ReferenceName = plumbing.NewBranchReferenceName(s.Ref)
+	wt, err = clone(ctx, opts)
+	if errors.Is(err, gogit.NoMatchingRefSpecError{}) {
+		return nil, fmt.Errorf("could not find tag, branch or commit %s in %s", s.Ref, s.URL)
+	}
+	return wt, err
+}
+
+func clone(ctx gocontext.Context, opts *gogit.CloneOptions) (billy.Filesystem, error) {
+	wt := memfs.New()
+	if _, err := gogit.CloneContext(ctx, memory.NewStorage(), wt, opts); err != nil {
+		return nil, fmt.Errorf("could not clone %s: %w", opts.URL, err)
+	}
+	return wt, nil
+}
+
+// copyBilly copies the dir directory of src billy.Filesystem into dst.
+func copyBilly(dst afero.Fs, src billy.Filesystem, dir string) error {
+	infos, err := src.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		name := path.Join(dir, info.Name())
+		if info.IsDir() {
+			if err := dst.MkdirAll(name, info.Mode().Perm()); err != nil {
+				return err
+			}
+			if err := copyBilly(dst, src, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		if err := copyBillyFile(dst, src, name); err != nil {
+			return fmt.Errorf("failed to copy %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func copyBillyFile(dst afero.Fs, src billy.Filesystem, name string) error {
+	f, err := src.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return afero.WriteReader(dst, name, f)
+}
@@ -0,0 +1,118 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package context
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGit(t *testing.T) {
+	tcs := map[string]struct {
+		arg      string
+		expected *GitSource
+	}{
+		"nominal":   {"git+https://host/org/repo.git", &GitSource{URL: "https://host/org/repo.git"}},
+		"subdir":    {"git+https://host/org/repo.git//deploy/prod/", &GitSource{URL: "https://host/org/repo.git", Subdir: "deploy/prod"}},
+		"ref":       {"git+https://host/org/repo.git?ref=v1.2.3", &GitSource{URL: "https://host/org/repo.git", Ref: "v1.2.3"}},
+		"full":      {"git+https://host/org/repo.git//deploy?ref=main", &GitSource{URL: "https://host/org/repo.git", Subdir: "deploy", Ref: "main"}},
+		"file":      {"git+file:///tmp/repo//deploy?ref=main", &GitSource{URL: "file:///tmp/repo", Subdir: "deploy", Ref: "main"}},
+		"ssh+port":  {"git+ssh://git@host:22/org/repo.git", &GitSource{URL: "ssh://git@host:22/org/repo.git"}},
+		"root only": {"git+https://host/org/repo.git//", &GitSource{URL: "https://host/org/repo.git"}},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			src, err := ParseGit(tc.arg)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, src)
+		})
+	}
+
+	_, err := ParseGit("https://host/org/repo.git")
+	assert.Error(t, err)
+}
+
+func commit(t *testing.T, r *gogit.Repository, dir, content string) plumbing.Hash {
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "deploy"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "deploy", "main.cue"), []byte(content), 0644))
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	_, err = w.Add("deploy/main.cue")
+	require.NoError(t, err)
+	h, err := w.Commit(content, &gogit.CommitOptions{
+		Author: &object.Signature{Name: "cuebe", Email: "cuebe@loftorbital.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+	return h
+}
+
+func TestGitFS(t *testing.T) {
+	if runtime.GOOS == "windows" && os.Getenv("CI") != "" {
+		t.Skip("skipping fs related test on windows")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("skipping test requiring git binary for the file transport")
+	}
+
+	dir := t.TempDir()
+	r, err := gogit.PlainInit(dir, false)
+	require.NoError(t, err)
+	first := commit(t, r, dir, "package v1")
+	_, err = r.CreateTag("v1.0.0", first, nil)
+	require.NoError(t, err)
+	commit(t, r, dir, "package v2")
+
+	ctx := context.Background()
+	repo := "git+file://" + filepath.ToSlash(dir)
+	tcs := map[string]struct {
+		arg      string
+		file     string
+		expected string
+	}{
+		"head":   {repo, "deploy/main.cue", "package v2"},
+		"tag":    {repo + "?ref=v1.0.0", "deploy/main.cue", "package v1"},
+		"branch": {repo + "?ref=master", "deploy/main.cue", "package v2"},
+		"commit": {repo + "//deploy?ref=" + first.String(), "main.cue", "package v1"},
+		"subdir": {repo + "//deploy", "main.cue", "package v2"},
+	}
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			fs, err := gitFS(ctx, tc.arg)
+			require.NoError(t, err)
+			b, err := afero.ReadFile(fs, tc.file)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(b))
+		})
+	}
+
+	_, err = gitFS(ctx, repo+"?ref=potato")
+	assert.ErrorContains(t, err, "could not find tag, branch or commit potato")
+	_, err = gitFS(ctx, repo+"//missing")
+	assert.ErrorContains(t, err, "could not find subdirectory missing")
+}
@@ -0,0 +1,191 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package context
+
+import (
+	"bufio"
+	"bytes"
+	gocontext "context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/loft-orbital/cuebe/internal/mod"
+	"github.com/loft-orbital/cuebe/pkg/cube"
+	"github.com/spf13/afero"
+)
+
+// httpCacheDir is the directory, relative to the cuebe cache, where pinned downloads are stored.
+const httpCacheDir = "contexts"
+
+// IsHTTP returns true if arg points to a remote HTTP(S) context.
+func IsHTTP(arg string) bool {
+	return strings.HasPrefix(arg, "https://") || strings.HasPrefix(arg, "http://")
+}
+
+// httpFS returns the filesystem of a remote context.
+// The remote resource is either a cube or a single CUE, YAML or JSON file.
+//
+// A sha256 checksum can be pinned with a #sha256=<hex> fragment.
+// Pinned resources are verified and cached locally.
+func httpFS(ctx gocontext.Context, raw string) (afero.Fs, error) {
+	u, sum, err := parseURL(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := download(ctx, u, sum)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := afero.NewMemMapFs()
+	r := bufio.NewReader(bytes.NewReader(data))
+	if cube.IsCube(r) {
+		if err := cube.Unpack(fs, r); err != nil {
+			return nil, fmt.Errorf("could not unpack cube: %w", err)
+		}
+		return fs, nil
+	}
+
+	name := path.Base(u.Path)
+	switch path.Ext(name) {
+	case ".cue", ".yaml", ".yml", ".json":
+	default:
+		return nil, fmt.Errorf("unsupported remote context %s: not a cube nor a CUE, YAML or JSON file", name)
+	}
+	return newSingleFile(name, data)
+}
+
+// parseURL parses a remote context url, returning it without its checksum fragment.
+func parseURL(raw string) (*url.URL, string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not parse url: %w", err)
+	}
+	sum, err := parseChecksum(u.Fragment)
+	if err != nil {
+		return nil, "", err
+	}
+	u.Fragment = ""
+	return u, sum, nil
+}
+
+func parseChecksum(fragment string) (string, error) {
+	if fragment == "" {
+		return "", nil
+	}
+	sum := strings.TrimPrefix(fragment, "sha256=")
+	if sum == fragment {
+		return "", fmt.Errorf("unsupported url fragment %q, expecting sha256=<hex>", fragment)
+	}
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid sha256 checksum %q", sum)
+	}
+	return strings.ToLower(sum), nil
+}
+
+// download gets the content at u.
+// If sum is not empty, the content is verified against it and served from the cache when possible.
+func download(ctx gocontext.Context, u *url.URL, sum string) ([]byte, error) {
+	if sum != "" {
+		if data, err := cacheGet(sum); err == nil {
+			return data, nil
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create request: %w", err)
+	}
+	setAuth(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not get %s: %w", u.Redacted(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("could not get %s: unexpected status %s", u.Redacted(), resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", u.Redacted(), err)
+	}
+
+	if sum != "" {
+		actual := sha256.Sum256(data)
+		if hex.EncodeToString(actual[:]) != sum {
+			return nil, fmt.Errorf("checksum mismatch for %s: expected sha256 %s, got %x", u.Redacted(), sum, actual)
+		}
+		// caching is best effort
+		_ = cachePut(sum, data)
+	}
+
+	return data, nil
+}
+
+// setAuth sets the request credentials, using the same resolution as private modules.
+// A token without user is sent as a bearer token, otherwise basic auth is used.
+func setAuth(req *http.Request) {
+	if req.URL.User != nil {
+		return
+	}
+	usr, pwd := mod.CredentialsFor(req.URL.Hostname())
+	switch {
+	case pwd == "":
+	case usr == "":
+		req.Header.Set("Authorization", "Bearer "+pwd)
+	default:
+		req.SetBasicAuth(usr, pwd)
+	}
+}
+
+func cacheGet(sum string) ([]byte, error) {
+	cd, err := mod.CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := util.ReadFile(cd, path.Join(httpCacheDir, sum))
+	if err != nil {
+		return nil, err
+	}
+	// never trust the cache blindly
+	if actual := sha256.Sum256(data); hex.EncodeToString(actual[:]) != sum {
+		return nil, errors.New("corrupted cache entry")
+	}
+	return data, nil
+}
+
+func cachePut(sum string, data []byte) error {
+	cd, err := mod.CacheDir()
+	if err != nil {
+		return err
+	}
+	if err := cd.MkdirAll(httpCacheDir, 0755); err != nil {
+		return err
+	}
+	return util.WriteFile(cd, path.Join(httpCacheDir, sum), data, os.FileMode(0644))
+}
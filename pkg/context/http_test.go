@@ -0,0 +1,147 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package context
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cubeOf(t *testing.T, name, content string) []byte {
+	buf := new(bytes.Buffer)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}))
+	_, err := tw.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func TestIsHTTP(t *testing.T) {
+	assert.True(t, IsHTTP("https://host/cube.tar.gz"))
+	assert.True(t, IsHTTP("http://host/main.cue"))
+	assert.False(t, IsHTTP("./http/main.cue"))
+	assert.False(t, IsHTTP("git+https://host/repo.git"))
+}
+
+func TestParseChecksum(t *testing.T) {
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte("cuebe")))
+
+	actual, err := parseChecksum("")
+	assert.NoError(t, err)
+	assert.Empty(t, actual)
+
+	actual, err = parseChecksum("sha256=" + strings.ToUpper(sum))
+	assert.NoError(t, err)
+	assert.Equal(t, sum, actual)
+
+	_, err = parseChecksum("md5=" + sum)
+	assert.ErrorContains(t, err, "unsupported url fragment")
+	_, err = parseChecksum("sha256=potato")
+	assert.ErrorContains(t, err, "invalid sha256 checksum")
+}
+
+func TestHTTPFS(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("NETRC", "/dev/null")
+
+	cube := cubeOf(t, "main.cue", "package main")
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		switch r.URL.Path {
+		case "/cube.tar.gz":
+			w.Write(cube)
+		case "/values.yaml":
+			w.Write([]byte("foo: bar"))
+		case "/private.cue":
+			if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("package main"))
+		case "/README.md":
+			w.Write([]byte("# cuebe"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	// cube
+	fs, err := httpFS(ctx, srv.URL+"/cube.tar.gz")
+	require.NoError(t, err)
+	b, err := afero.ReadFile(fs, "main.cue")
+	assert.NoError(t, err)
+	assert.Equal(t, "package main", string(b))
+
+	// single file
+	fs, err = httpFS(ctx, srv.URL+"/values.yaml")
+	require.NoError(t, err)
+	b, err = afero.ReadFile(fs, "values.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo: bar", string(b))
+
+	// unsupported file
+	_, err = httpFS(ctx, srv.URL+"/README.md")
+	assert.ErrorContains(t, err, "unsupported remote context README.md")
+
+	// not found
+	_, err = httpFS(ctx, srv.URL+"/missing.cue")
+	assert.ErrorContains(t, err, "unexpected status 404 Not Found")
+
+	// bearer auth
+	_, err = httpFS(ctx, srv.URL+"/private.cue")
+	assert.ErrorContains(t, err, "unexpected status 401 Unauthorized")
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	t.Setenv(strings.ToUpper(strings.ReplaceAll(u.Hostname(), ".", "_"))+"_TOKEN", "s3cr3t")
+	_, err = httpFS(ctx, srv.URL+"/private.cue")
+	assert.NoError(t, err)
+
+	// checksum mismatch
+	_, err = httpFS(ctx, fmt.Sprintf("%s/cube.tar.gz#sha256=%x", srv.URL, sha256.Sum256([]byte("potato"))))
+	assert.ErrorContains(t, err, "checksum mismatch")
+
+	// pinned checksum is served from cache
+	pinned := fmt.Sprintf("%s/cube.tar.gz#sha256=%x", srv.URL, sha256.Sum256(cube))
+	_, err = httpFS(ctx, pinned)
+	require.NoError(t, err)
+	atomic.StoreInt32(&hits, 0)
+	fs, err = httpFS(ctx, pinned)
+	require.NoError(t, err)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&hits))
+	b, err = afero.ReadFile(fs, "main.cue")
+	assert.NoError(t, err)
+	assert.Equal(t, "package main", string(b))
+}
@@ -0,0 +1,85 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package context
+
+import (
+	"bufio"
+	"errors"
+	iofs "io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	"github.com/spf13/afero"
+)
+
+// IgnoreFile is the name of the files listing paths to leave out of a Context.
+// It follows the .gitignore syntax, and applies to the directory it is in.
+const IgnoreFile = ".cuebeignore"
+
+// ignorer tracks the ignore patterns of a filesystem while walking it.
+type ignorer struct {
+	fs       afero.Fs
+	patterns []gitignore.Pattern
+}
+
+func newIgnorer(fs afero.Fs) *ignorer {
+	return &ignorer{fs: fs}
+}
+
+// Ignore returns true if the file should be left out.
+// It must be called for every directory before their content, as afero.Walk does.
+func (i *ignorer) Ignore(name string, info iofs.FileInfo) (bool, error) {
+	parts := splitPath(name)
+	if len(parts) > 0 && gitignore.NewMatcher(i.patterns).Match(parts, info.IsDir()) {
+		return true, nil
+	}
+	if info.IsDir() {
+		return false, i.load(parts)
+	}
+	return false, nil
+}
+
+// load appends the patterns of the ignore file in dir, if any.
+func (i *ignorer) load(dir []string) error {
+	f, err := i.fs.Open(path.Join(append(dir, IgnoreFile)...))
+	if errors.Is(err, iofs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		i.patterns = append(i.patterns, gitignore.ParsePattern(line, dir))
+	}
+	return scanner.Err()
+}
+
+func splitPath(name string) []string {
+	name = strings.Trim(filepath.ToSlash(name), "/")
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
@@ -0,0 +1,120 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package context
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/loft-orbital/cuebe/pkg/cube"
+	"github.com/spf13/afero"
+)
+
+// ConflictStrategy defines what happens when a layer overrides
+// a file of the Context with a different content.
+type ConflictStrategy string
+
+const (
+	// OnConflictOverride silently overrides the file.
+	OnConflictOverride ConflictStrategy = "override"
+	// OnConflictWarn overrides the file and logs a warning.
+	OnConflictWarn ConflictStrategy = "warn"
+	// OnConflictError fails.
+	OnConflictError ConflictStrategy = "error"
+)
+
+// ParseConflictStrategy returns the ConflictStrategy named s.
+func ParseConflictStrategy(s string) (ConflictStrategy, error) {
+	switch cs := ConflictStrategy(s); cs {
+	case OnConflictOverride, OnConflictWarn, OnConflictError:
+		return cs, nil
+	default:
+		return "", fmt.Errorf("unknown conflict strategy %q, expecting one of error, warn or override", s)
+	}
+}
+
+// ConflictError is returned when a layer overrides a file
+// and the Context uses the OnConflictError strategy.
+type ConflictError struct {
+	// Path is the conflicting file.
+	Path string
+	// Layer is the layer trying to override the file.
+	Layer string
+	// Previous is the layer the file comes from.
+	Previous string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s from %s conflicts with %s", e.Path, e.Layer, e.Previous)
+}
+
+// File represents the provenance of a Context file.
+type File struct {
+	// Path is the file path, relative to the Context root.
+	Path string
+	// Layers are the layers that provided this file, in order.
+	// The last one is the actual source, the others were overridden.
+	Layers []string
+}
+
+// Files returns the provenance of every file of the Context, sorted by path.
+func (c *Context) Files() []File {
+	files := make([]File, 0, len(c.origins))
+	for p, layers := range c.origins {
+		files = append(files, File{Path: p, Layers: append([]string(nil), layers...)})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files
+}
+
+// track records that layer provides its file name as the Context file target,
+// applying the Context conflict strategy when it was already provided.
+func (c *Context) track(layer string, fs afero.Fs, name, target string) error {
+	prev := c.origins[target]
+	c.origins[target] = append(prev, layer)
+	if len(prev) == 0 || c.OnConflict == OnConflictOverride || c.OnConflict == "" {
+		return nil
+	}
+	// every cube carries its own metadata, the last one simply wins
+	if target == filepath.ToSlash(cube.MetadataFile) {
+		return nil
+	}
+
+	same, err := sameContent(c.fs, target, fs, name)
+	if err != nil || same {
+		return err
+	}
+	cerr := &ConflictError{Path: target, Layer: layer, Previous: prev[len(prev)-1]}
+	if c.OnConflict == OnConflictError {
+		return cerr
+	}
+	c.logger().Error("warning: %s\n", cerr)
+	return nil
+}
+
+func sameContent(a afero.Fs, aname string, b afero.Fs, bname string) (bool, error) {
+	ab, err := afero.ReadFile(a, aname)
+	if err != nil {
+		return false, err
+	}
+	bb, err := afero.ReadFile(b, bname)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ab, bb), nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package context
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/loft-orbital/cuebe/internal/oci"
+	"github.com/spf13/afero"
+)
+
+// SplitMount splits a src:dst argument into its source and mount point.
+// Only local paths and StdinArg can be mounted: an argument that is a remote context,
+// or an existing local path, is returned as is with an empty mount point.
+// A mount point ending with a slash is a directory.
+func SplitMount(arg string) (src, dst string, err error) {
+	if IsGit(arg) || IsHTTP(arg) || oci.IsReference(arg) {
+		return arg, "", nil
+	}
+	if _, err := os.Stat(arg); err == nil {
+		return arg, "", nil
+	}
+	vol := len(filepath.VolumeName(arg))
+	i := strings.LastIndex(arg[vol:], ":")
+	if i < 0 {
+		return arg, "", nil
+	}
+	src, dst = arg[:vol+i], filepath.ToSlash(arg[vol+i+1:])
+
+	dir := strings.HasSuffix(dst, "/")
+	clean := path.Clean(dst)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", "", fmt.Errorf("invalid mount point %s: must be relative to the context root", dst)
+	}
+	if clean == "." {
+		return src, "", nil
+	}
+	if dir {
+		clean += "/"
+	}
+	return src, clean, nil
+}
+
+// singleFile is a filesystem holding a single file, at its root.
+type singleFile struct {
+	afero.Fs
+	name string
+}
+
+// newSingleFile returns a filesystem holding data as name.
+func newSingleFile(name string, data []byte) (*singleFile, error) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, name, data, 0644); err != nil {
+		return nil, fmt.Errorf("could not write %s: %w", name, err)
+	}
+	return &singleFile{Fs: fs, name: name}, nil
+}
+
+// mount returns the filesystem to mount at dst and the directory to mount it in.
+// A single file mounted on a file path is renamed after it, anything else is mounted under dst.
+func mount(fs afero.Fs, dst string) (afero.Fs, string, error) {
+	sf, ok := fs.(*singleFile)
+	if !ok || dst == "" || strings.HasSuffix(dst, "/") {
+		return fs, strings.TrimSuffix(dst, "/"), nil
+	}
+
+	data, err := afero.ReadFile(sf, sf.name)
+	if err != nil {
+		return nil, "", fmt.Errorf("could not read %s: %w", sf.name, err)
+	}
+	renamed, err := newSingleFile(path.Base(dst), data)
+	if err != nil {
+		return nil, "", err
+	}
+	dir := path.Dir(dst)
+	if dir == "." {
+		dir = ""
+	}
+	return renamed, dir, nil
+}
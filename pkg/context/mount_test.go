@@ -0,0 +1,87 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package context
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitMount(t *testing.T) {
+	dir := t.TempDir()
+	colon := filepath.Join(dir, "with:colon")
+	require.NoError(t, os.Mkdir(colon, 0755))
+
+	for arg, expected := range map[string][2]string{
+		".":                               {".", ""},
+		"../shared:secrets/":              {"../shared", "secrets/"},
+		"../shared:secrets":               {"../shared", "secrets"},
+		"./prod.cue:overrides/prod.cue":   {"./prod.cue", "overrides/prod.cue"},
+		"-:values.yaml":                   {"-", "values.yaml"},
+		"dir:./":                          {"dir", ""},
+		"dir:a/../b/":                     {"dir", "b/"},
+		colon:                             {colon, ""},
+		"https://host/cube.tar.gz":        {"https://host/cube.tar.gz", ""},
+		"oci://localhost:5000/app:1.0.0":  {"oci://localhost:5000/app:1.0.0", ""},
+		"git+ssh://git@host:org/repo.git": {"git+ssh://git@host:org/repo.git", ""},
+	} {
+		src, dst, err := SplitMount(arg)
+		assert.NoError(t, err, arg)
+		assert.Equal(t, expected, [2]string{src, dst}, arg)
+	}
+
+	_, _, err := SplitMount("dir:/etc")
+	assert.ErrorContains(t, err, "invalid mount point /etc")
+	_, _, err = SplitMount("dir:../escape")
+	assert.ErrorContains(t, err, "invalid mount point ../escape")
+}
+
+func TestFromArgsMount(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "shared"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "shared", "secret.cue"), []byte("package main"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "prod.cue"), []byte("package prod"), 0644))
+
+	ctx, err := FromArgs(context.Background(), []string{
+		filepath.Join(dir, "prod.cue"),
+		filepath.Join(dir, "shared") + ":secrets/",
+		filepath.Join(dir, "prod.cue") + ":overrides/prod.cue",
+		filepath.Join(dir, "prod.cue") + ":copies/",
+		"-:values.yaml",
+	}, &Options{Stdin: strings.NewReader("a: int")})
+	require.NoError(t, err)
+
+	fs := ctx.GetAferoFS()
+	for name, content := range map[string]string{
+		"prod.cue":           "package prod",
+		"secrets/secret.cue": "package main",
+		"overrides/prod.cue": "package prod",
+		"copies/prod.cue":    "package prod",
+		"values.yaml":        "a: int",
+	} {
+		b, err := afero.ReadFile(fs, name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, content, string(b), name)
+	}
+	assert.Len(t, ctx.Files(), 5)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package context
+
+import (
+	"bufio"
+	"bytes"
+	gocontext "context"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/loft-orbital/cuebe/internal/oci"
+	"github.com/loft-orbital/cuebe/pkg/cube"
+	"github.com/spf13/afero"
+)
+
+// signedFS returns the filesystem of an argument, verifying the signature of cubes against key.
+// Local directories and plain files are trusted as is, only cube archives are verified.
+// Remote arguments must be signed cubes: HTTP(S) cubes have their signature next to them,
+// OCI cubes have it pushed along. Git repositories can't be verified.
+func signedFS(ctx gocontext.Context, arg string, key ed25519.PublicKey) (afero.Fs, error) {
+	var data, sig []byte
+	switch {
+	case IsGit(arg):
+		return nil, errors.New("signature required: git repositories cannot be verified")
+	case oci.IsReference(arg):
+		ref, err := oci.ParseReference(arg)
+		if err != nil {
+			return nil, err
+		}
+		if data, sig, err = oci.PullSigned(ctx, ref); err != nil {
+			return nil, fmt.Errorf("could not pull %s: %w", ref, err)
+		}
+		if sig == nil {
+			return nil, fmt.Errorf("could not get signature: %s was pushed without signature", ref)
+		}
+	case IsHTTP(arg):
+		u, sum, err := parseURL(arg)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = download(ctx, u, sum); err != nil {
+			return nil, err
+		}
+		if !cube.IsCube(bufio.NewReader(bytes.NewReader(data))) {
+			return nil, errors.New("signature required: not a cube")
+		}
+		su := *u
+		su.Path += cube.SignatureExt
+		if sig, err = download(ctx, &su, ""); err != nil {
+			return nil, fmt.Errorf("could not get signature: %w", err)
+		}
+	default:
+		name, err := absPath(arg)
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(name); err == nil && info.IsDir() {
+			return localFS(name)
+		}
+		if data, err = os.ReadFile(name); err != nil {
+			return nil, err
+		}
+		if !cube.IsCube(bufio.NewReader(bytes.NewReader(data))) {
+			return newSingleFile(path.Base(name), data)
+		}
+		if sig, err = os.ReadFile(name + cube.SignatureExt); err != nil {
+			return nil, fmt.Errorf("could not read signature: %w", err)
+		}
+	}
+
+	if err := cube.Verify(key, data, sig); err != nil {
+		return nil, err
+	}
+
+	fs := afero.NewMemMapFs()
+	if err := cube.Unpack(fs, bufio.NewReader(bytes.NewReader(data))); err != nil {
+		return nil, fmt.Errorf("could not unpack cube: %w", err)
+	}
+	return fs, nil
+}
@@ -0,0 +1,152 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package context
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/loft-orbital/cuebe/internal/oci"
+	"github.com/loft-orbital/cuebe/pkg/cube"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedFS(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("NETRC", "/dev/null")
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	data := cubeOf(t, "main.cue", "package main")
+	dir := t.TempDir()
+	signed := filepath.Join(dir, "signed.tar.gz")
+	require.NoError(t, os.WriteFile(signed, data, 0644))
+	require.NoError(t, os.WriteFile(signed+cube.SignatureExt, cube.Sign(priv, data), 0644))
+	unsigned := filepath.Join(dir, "unsigned.tar.gz")
+	require.NoError(t, os.WriteFile(unsigned, data, 0644))
+
+	ctx := context.Background()
+
+	// local cube
+	fs, err := signedFS(ctx, signed, pub)
+	require.NoError(t, err)
+	b, err := afero.ReadFile(fs, "main.cue")
+	assert.NoError(t, err)
+	assert.Equal(t, "package main", string(b))
+
+	_, err = signedFS(ctx, signed, other)
+	assert.ErrorIs(t, err, cube.ErrInvalidSignature)
+	_, err = signedFS(ctx, unsigned, pub)
+	assert.ErrorContains(t, err, "could not read signature")
+
+	// local plain layers and files are not verified
+	plain := filepath.Join(dir, "values.yaml")
+	require.NoError(t, os.WriteFile(plain, []byte("replicas: 2"), 0644))
+	fs, err = signedFS(ctx, dir, pub)
+	require.NoError(t, err)
+	_, err = afero.ReadFile(fs, "values.yaml")
+	assert.NoError(t, err)
+	fs, err = signedFS(ctx, plain, pub)
+	require.NoError(t, err)
+	b, err = afero.ReadFile(fs, "values.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "replicas: 2", string(b))
+
+	_, err = signedFS(ctx, "git+https://github.com/org/app.git", pub)
+	assert.ErrorContains(t, err, "git repositories cannot be verified")
+
+	// remote cube
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer srv.Close()
+	fs, err = signedFS(ctx, srv.URL+"/signed.tar.gz", pub)
+	require.NoError(t, err)
+	b, err = afero.ReadFile(fs, "main.cue")
+	assert.NoError(t, err)
+	assert.Equal(t, "package main", string(b))
+	_, err = signedFS(ctx, srv.URL+"/unsigned.tar.gz", pub)
+	assert.ErrorContains(t, err, "could not get signature")
+	_, err = signedFS(ctx, srv.URL+"/values.yaml", pub)
+	assert.ErrorContains(t, err, "not a cube")
+
+	// OCI cube
+	reg := httptest.NewServer(ociRegistry(map[string][][]byte{
+		"signed":   {data, cube.Sign(priv, data)},
+		"unsigned": {data},
+	}))
+	defer reg.Close()
+	host := strings.TrimPrefix(reg.URL, "http://")
+	fs, err = signedFS(ctx, "oci://"+host+"/org/app:signed", pub)
+	require.NoError(t, err)
+	b, err = afero.ReadFile(fs, "main.cue")
+	assert.NoError(t, err)
+	assert.Equal(t, "package main", string(b))
+	_, err = signedFS(ctx, "oci://"+host+"/org/app:signed", other)
+	assert.ErrorIs(t, err, cube.ErrInvalidSignature)
+	_, err = signedFS(ctx, "oci://"+host+"/org/app:unsigned", pub)
+	assert.ErrorContains(t, err, "pushed without signature")
+
+	// through FromArgs
+	_, err = FromArgs(ctx, []string{signed, unsigned}, &Options{PublicKey: pub})
+	assert.ErrorContains(t, err, "could not load "+unsigned)
+	c, err := FromArgs(ctx, []string{signed, plain}, &Options{PublicKey: pub})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"values.yaml"}, c.Overrides())
+}
+
+// ociRegistry serves the cubes of tags, with their signature if any, as a read-only OCI registry.
+func ociRegistry(tags map[string][][]byte) http.Handler {
+	blobs := map[string][]byte{}
+	manifests := map[string][]byte{}
+	add := func(mediaType string, data []byte) oci.Descriptor {
+		d := fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+		blobs[d] = data
+		return oci.Descriptor{MediaType: mediaType, Digest: d, Size: int64(len(data))}
+	}
+	for tag, layers := range tags {
+		m := oci.Manifest{SchemaVersion: 2, MediaType: oci.ManifestMediaType, Config: add(oci.ConfigMediaType, []byte("{}"))}
+		m.Layers = append(m.Layers, add(oci.CubeMediaType, layers[0]))
+		if len(layers) > 1 {
+			m.Layers = append(m.Layers, add(oci.SignatureMediaType, layers[1]))
+		}
+		manifests[tag], _ = json.Marshal(m)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := manifests[strings.TrimPrefix(r.URL.Path, "/v2/org/app/manifests/")]
+		if !ok {
+			data, ok = blobs[strings.TrimPrefix(r.URL.Path, "/v2/org/app/blobs/")]
+		}
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	})
+}
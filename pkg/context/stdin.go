@@ -0,0 +1,88 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package context
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	"cuelang.org/go/cue/cuecontext"
+	"cuelang.org/go/cue/parser"
+	"github.com/loft-orbital/cuebe/pkg/cube"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+// StdinArg is the argument standing for the standard input.
+const StdinArg = "-"
+
+// Names given to a single document read from the standard input.
+const (
+	StdinCUE  = "stdin.cue"
+	StdinYAML = "stdin.yaml"
+)
+
+// stdinFS returns the filesystem of a context read from r.
+// r is either a tar archive, compressed (cube) or not, or a single CUE or YAML document.
+// A document is considered CUE if it has a package clause or is valid standalone CUE,
+// YAML otherwise. It is named StdinCUE or StdinYAML accordingly.
+func stdinFS(r io.Reader) (afero.Fs, error) {
+	if r == nil {
+		return nil, errors.New("standard input is not available")
+	}
+
+	fs := afero.NewMemMapFs()
+	br := bufio.NewReader(r)
+	switch {
+	case cube.IsCube(br):
+		if err := cube.Unpack(fs, br); err != nil {
+			return nil, fmt.Errorf("could not unpack cube: %w", err)
+		}
+		return fs, nil
+	case cube.IsTar(br):
+		if err := cube.UnpackTar(fs, br); err != nil {
+			return nil, fmt.Errorf("could not unpack archive: %w", err)
+		}
+		return fs, nil
+	}
+
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return nil, fmt.Errorf("could not read standard input: %w", err)
+	}
+	name, err := documentName(data)
+	if err != nil {
+		return nil, err
+	}
+	return newSingleFile(name, data)
+}
+
+// documentName guesses the format of a single document and returns its file name.
+func documentName(data []byte) (string, error) {
+	if f, err := parser.ParseFile(StdinCUE, data); err == nil {
+		// a package may reference the rest of the context, it can't be built alone
+		if f.PackageName() != "" || cuecontext.New().BuildFile(f).Err() == nil {
+			return StdinCUE, nil
+		}
+	}
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return "", errors.New("standard input is not an archive nor a CUE or YAML document")
+	}
+	return StdinYAML, nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package context
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStdinFS(t *testing.T) {
+	// cube
+	fs, err := stdinFS(bytes.NewReader(cubeOf(t, "main.cue", "package main")))
+	require.NoError(t, err)
+	b, err := afero.ReadFile(fs, "main.cue")
+	assert.NoError(t, err)
+	assert.Equal(t, "package main", string(b))
+
+	// uncompressed archive, e.g. git archive
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "app/main.cue", Typeflag: tar.TypeReg, Mode: 0644, Size: 12}))
+	_, err = tw.Write([]byte("package main"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	fs, err = stdinFS(buf)
+	require.NoError(t, err)
+	b, err = afero.ReadFile(fs, "app/main.cue")
+	assert.NoError(t, err)
+	assert.Equal(t, "package main", string(b))
+
+	// single documents
+	for content, name := range map[string]string{
+		"package main\na: b":    StdinCUE,
+		"a: int":                StdinCUE,
+		`{"a": 1}`:              StdinCUE,
+		"a: b":                  StdinYAML,
+		"# comment\nlist:\n- a": StdinYAML,
+	} {
+		fs, err := stdinFS(strings.NewReader(content))
+		require.NoError(t, err, content)
+		b, err := afero.ReadFile(fs, name)
+		assert.NoError(t, err, content)
+		assert.Equal(t, content, string(b))
+	}
+
+	_, err = stdinFS(strings.NewReader("a: [b: c"))
+	assert.ErrorContains(t, err, "not an archive nor a CUE or YAML document")
+	_, err = stdinFS(nil)
+	assert.ErrorContains(t, err, "standard input is not available")
+}
+
+func TestFromArgsStdin(t *testing.T) {
+	ctx, err := FromArgs(context.Background(), []string{"-"}, &Options{Stdin: strings.NewReader("a: b")})
+	require.NoError(t, err)
+	assert.Equal(t, []File{{Path: StdinYAML, Layers: []string{"-"}}}, ctx.Files())
+	assert.Equal(t, StdinYAML, ctx.Stdin())
+	assert.Empty(t, ctx.Overrides())
+
+	// mounted
+	ctx, err = FromArgs(context.Background(), []string{"-:values.yaml"}, &Options{Stdin: strings.NewReader("a: b")})
+	require.NoError(t, err)
+	assert.Equal(t, "values.yaml", ctx.Stdin())
+
+	_, err = FromArgs(context.Background(), []string{"-", "-"}, &Options{Stdin: strings.NewReader("a: b")})
+	assert.ErrorContains(t, err, "standard input can only be used once")
+}
@@ -0,0 +1,136 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cube
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// gzipMagic is the header every gzip stream starts with.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// IsCube reports whether r starts like a cube (gzip-compressed tar archive).
+// It only peeks at r, so r can still be used to read the whole cube afterward.
+func IsCube(r *bufio.Reader) bool {
+	b, err := r.Peek(len(gzipMagic))
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(b, gzipMagic)
+}
+
+// tarMagic is the magic of POSIX (ustar) and GNU tar headers, found at tarMagicOffset.
+var tarMagic = []byte("ustar")
+
+const tarMagicOffset = 257
+
+// IsTar reports whether r starts like an uncompressed tar archive.
+// It only peeks at r, so r can still be used to read the whole archive afterward.
+func IsTar(r *bufio.Reader) bool {
+	b, err := r.Peek(tarMagicOffset + len(tarMagic))
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(b[tarMagicOffset:], tarMagic)
+}
+
+// Unpack extracts the cube read from r into dst.
+func Unpack(dst afero.Fs, r io.Reader) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("could not open gzip stream: %w", err)
+	}
+	defer gr.Close()
+
+	return unpackTar(dst, tar.NewReader(gr))
+}
+
+// UnpackTar extracts the uncompressed tar archive read from r into dst.
+func UnpackTar(dst afero.Fs, r io.Reader) error {
+	return unpackTar(dst, tar.NewReader(r))
+}
+
+func unpackTar(dst afero.Fs, tr *tar.Reader) error {
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read archive: %w", err)
+		}
+
+		name, err := entryName(header.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := dst.MkdirAll(name, header.FileInfo().Mode().Perm()); err != nil {
+				return fmt.Errorf("could not create directory %s: %w", name, err)
+			}
+		case tar.TypeReg:
+			if err := dst.MkdirAll(path.Dir(name), 0755); err != nil {
+				return fmt.Errorf("could not create directory %s: %w", path.Dir(name), err)
+			}
+			if err := writeFile(dst, name, header.FileInfo().Mode().Perm(), tr); err != nil {
+				return fmt.Errorf("could not extract %s: %w", name, err)
+			}
+		default:
+			// links, devices and global headers have no meaning in a context
+			continue
+		}
+	}
+}
+
+// entryName returns the cleaned relative name of an archive entry.
+// It fails if the entry would be extracted outside of the archive root.
+func entryName(name string) (string, error) {
+	clean := path.Clean("/" + name)
+	if clean == "/" {
+		return "", nil
+	}
+	if strings.HasPrefix(path.Clean(name), "..") {
+		return "", fmt.Errorf("illegal archive entry %s", name)
+	}
+	return strings.TrimPrefix(clean, "/"), nil
+}
+
+func writeFile(dst afero.Fs, name string, perm os.FileMode, r io.Reader) error {
+	f, err := dst.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	return err
+}
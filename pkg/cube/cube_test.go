@@ -0,0 +1,127 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cube
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func archive(t *testing.T, files map[string]string) []byte {
+	buf := new(bytes.Buffer)
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	for name, content := range files {
+		if strings.HasSuffix(name, "/") {
+			require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755}))
+			continue
+		}
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	return buf.Bytes()
+}
+
+func TestIsCube(t *testing.T) {
+	assert.True(t, IsCube(bufio.NewReader(bytes.NewReader(archive(t, nil)))))
+	assert.False(t, IsCube(bufio.NewReader(strings.NewReader("package main"))))
+	assert.False(t, IsCube(bufio.NewReader(strings.NewReader(""))))
+}
+
+func TestUnpack(t *testing.T) {
+	data := archive(t, map[string]string{
+		"empty/":            "",
+		"main.cue":          "package main",
+		"./nested/file.yml": "foo: bar",
+	})
+
+	fs := afero.NewMemMapFs()
+	require.NoError(t, Unpack(fs, bytes.NewReader(data)))
+
+	b, err := afero.ReadFile(fs, "main.cue")
+	assert.NoError(t, err)
+	assert.Equal(t, "package main", string(b))
+	b, err = afero.ReadFile(fs, "nested/file.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo: bar", string(b))
+	stat, err := fs.Stat("empty")
+	assert.NoError(t, err)
+	assert.True(t, stat.IsDir())
+
+	// not a gzip stream
+	assert.Error(t, Unpack(fs, strings.NewReader("package main")))
+
+	// escaping the archive root
+	data = archive(t, map[string]string{"../evil.cue": "package evil"})
+	assert.ErrorContains(t, Unpack(afero.NewMemMapFs(), bytes.NewReader(data)), "illegal archive entry ../evil.cue")
+}
+
+func TestPack(t *testing.T) {
+	src := func(mtime time.Time, order []string) afero.Fs {
+		fs := afero.NewMemMapFs()
+		files := map[string]string{"main.cue": "package main", "nested/file.yml": "foo: bar"}
+		for _, name := range order {
+			require.NoError(t, afero.WriteFile(fs, name, []byte(files[name]), 0600))
+			require.NoError(t, fs.Chtimes(name, mtime, mtime))
+		}
+		return fs
+	}
+
+	b1 := new(bytes.Buffer)
+	d1, err := Pack(b1, src(time.Now(), []string{"main.cue", "nested/file.yml"}))
+	require.NoError(t, err)
+	b2 := new(bytes.Buffer)
+	d2, err := Pack(b2, src(time.Unix(42, 0), []string{"nested/file.yml", "main.cue"}))
+	require.NoError(t, err)
+
+	assert.Equal(t, b1.Bytes(), b2.Bytes())
+	assert.Equal(t, d1, d2)
+	assert.Equal(t, fmt.Sprintf("sha256:%x", sha256.Sum256(b1.Bytes())), d1)
+
+	fs := afero.NewMemMapFs()
+	require.NoError(t, Unpack(fs, b1))
+	b, err := afero.ReadFile(fs, "nested/file.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo: bar", string(b))
+}
+
+func TestUnpackTar(t *testing.T) {
+	gr, err := gzip.NewReader(bytes.NewReader(archive(t, map[string]string{"main.cue": "package main"})))
+	require.NoError(t, err)
+	r := bufio.NewReader(gr)
+	assert.True(t, IsTar(r))
+	assert.False(t, IsTar(bufio.NewReader(strings.NewReader("package main"))))
+
+	fs := afero.NewMemMapFs()
+	require.NoError(t, UnpackTar(fs, r))
+	b, err := afero.ReadFile(fs, "main.cue")
+	assert.NoError(t, err)
+	assert.Equal(t, "package main", string(b))
+}
@@ -0,0 +1,154 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cube
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/parser"
+	"github.com/loft-orbital/cuebe/pkg/modfile"
+	"github.com/spf13/afero"
+)
+
+// MetadataFile is the location of the metadata file inside a cube.
+var MetadataFile = path.Join(".cuebe", "metadata.json")
+
+// Metadata describes what a cube was packed from.
+type Metadata struct {
+	// Module is the CUE module path, from cue.mod/module.cue.
+	Module string `json:"module,omitempty"`
+	// Commit is the git commit the cube was packed from.
+	Commit string `json:"commit,omitempty"`
+	// CuebeVersion is the version of cuebe that packed the cube.
+	CuebeVersion string `json:"cuebeVersion,omitempty"`
+	// Created is the cube creation time.
+	Created time.Time `json:"created"`
+	// Tags lists the tags declared with @tag() attributes.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// NewMetadata returns the metadata that can be collected from fs content:
+// its module path and its declared tags.
+func NewMetadata(fs afero.Fs) (*Metadata, error) {
+	m := new(Metadata)
+
+	b, err := afero.ReadFile(fs, modfile.CueModFile)
+	switch {
+	case err == nil:
+		mf, err := modfile.ParseBytes(modfile.CueModFile, b)
+		if err != nil {
+			return nil, err
+		}
+		m.Module = mf.Module
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("could not read modfile: %w", err)
+	}
+
+	m.Tags, err = declaredTags(fs)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// declaredTags returns the sorted names of the tags declared in fs CUE files.
+// Dependencies, in cue.mod, are left out.
+func declaredTags(fs afero.Fs) ([]string, error) {
+	set := make(map[string]struct{})
+	err := afero.Walk(fs, "", func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if name == "cue.mod" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(name) != ".cue" {
+			return nil
+		}
+
+		src, err := afero.ReadFile(fs, name)
+		if err != nil {
+			return fmt.Errorf("could not read %s: %w", name, err)
+		}
+		f, err := parser.ParseFile(name, src)
+		if err != nil {
+			return fmt.Errorf("could not parse %s: %w", name, err)
+		}
+		ast.Walk(f, func(n ast.Node) bool {
+			if a, ok := n.(*ast.Attribute); ok {
+				if key, body := a.Split(); key == "tag" {
+					tag := strings.TrimSpace(strings.SplitN(body, ",", 2)[0])
+					set[tag] = struct{}{}
+				}
+			}
+			return true
+		}, nil)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]string, 0, len(set))
+	for t := range set {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// ReadMetadata reads the metadata of an unpacked cube.
+func ReadMetadata(fs afero.Fs) (*Metadata, error) {
+	b, err := afero.ReadFile(fs, MetadataFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read metadata: %w", err)
+	}
+	m := new(Metadata)
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("could not decode metadata: %w", err)
+	}
+	return m, nil
+}
+
+// WithMetadata returns a filesystem layering m, at MetadataFile, on top of fs.
+// fs is left untouched.
+func WithMetadata(fs afero.Fs, m *Metadata) (afero.Fs, error) {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("could not encode metadata: %w", err)
+	}
+
+	layered := afero.NewCopyOnWriteFs(afero.NewReadOnlyFs(fs), afero.NewMemMapFs())
+	if err := layered.MkdirAll(path.Dir(MetadataFile), 0755); err != nil {
+		return nil, fmt.Errorf("could not create metadata directory: %w", err)
+	}
+	if err := afero.WriteFile(layered, MetadataFile, append(b, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("could not write metadata: %w", err)
+	}
+	return layered, nil
+}
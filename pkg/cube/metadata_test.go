@@ -0,0 +1,81 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cube
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMetadata(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "cue.mod/module.cue", []byte(`module: "host.com/app"`), 0644))
+	require.NoError(t, afero.WriteFile(fs, "cue.mod/pkg/dep/dep.cue", []byte(`package dep
+ignored: string @tag(ignored)`), 0644))
+	require.NoError(t, afero.WriteFile(fs, "main.cue", []byte(`package main
+env:    *"dev" | string @tag(env)
+debug:  *false | bool   @tag(debug,type=bool)
+region: string          @tag(region) @other(attr)`), 0644))
+	require.NoError(t, afero.WriteFile(fs, "values.yaml", []byte("a: b"), 0644))
+
+	m, err := NewMetadata(fs)
+	require.NoError(t, err)
+	assert.Equal(t, "host.com/app", m.Module)
+	assert.Equal(t, []string{"debug", "env", "region"}, m.Tags)
+
+	// no module
+	m, err = NewMetadata(afero.NewMemMapFs())
+	assert.NoError(t, err)
+	assert.Empty(t, m.Module)
+
+	require.NoError(t, afero.WriteFile(fs, "broken.cue", []byte("a: {"), 0644))
+	_, err = NewMetadata(fs)
+	assert.ErrorContains(t, err, "could not parse broken.cue")
+}
+
+func TestWithMetadata(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "main.cue", []byte("package main"), 0644))
+
+	_, err := ReadMetadata(fs)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	m := &Metadata{Module: "host.com/app", Commit: "abc", CuebeVersion: "v1.0.0", Created: time.Unix(42, 0).UTC(), Tags: []string{"env"}}
+	layered, err := WithMetadata(fs, m)
+	require.NoError(t, err)
+	exists, err := afero.Exists(fs, MetadataFile)
+	assert.NoError(t, err)
+	assert.False(t, exists, "source fs must be left untouched")
+
+	buf := new(bytes.Buffer)
+	_, err = Pack(buf, layered)
+	require.NoError(t, err)
+	unpacked := afero.NewMemMapFs()
+	require.NoError(t, Unpack(unpacked, buf))
+
+	actual, err := ReadMetadata(unpacked)
+	assert.NoError(t, err)
+	assert.Equal(t, m, actual)
+	b, err := afero.ReadFile(unpacked, "main.cue")
+	assert.NoError(t, err)
+	assert.Equal(t, "package main", string(b))
+}
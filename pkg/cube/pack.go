@@ -0,0 +1,107 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cube
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// epoch is the modification time of every packed file.
+var epoch = time.Unix(0, 0)
+
+// Pack writes the content of fs as a cube to w and returns its digest (sha256:<hex>).
+// Packing is reproducible: entries are sorted and their timestamps, ownership
+// and permissions normalized, so the same content always produces the same cube.
+func Pack(w io.Writer, fs afero.Fs) (string, error) {
+	h := sha256.New()
+	gw, err := gzip.NewWriterLevel(io.MultiWriter(w, h), gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	tw := tar.NewWriter(gw)
+
+	// afero.Walk visits entries in lexical order
+	err = afero.Walk(fs, "", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			return nil
+		}
+		if err := tw.WriteHeader(header(filepath.ToSlash(path), info)); err != nil {
+			return fmt.Errorf("could not write header of %s: %w", path, err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return copyFile(tw, fs, path)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := tw.Close(); err != nil {
+		return "", fmt.Errorf("could not close archive: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return "", fmt.Errorf("could not close gzip stream: %w", err)
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
+
+// header returns a normalized tar header for the entry name.
+func header(name string, info os.FileInfo) *tar.Header {
+	h := &tar.Header{
+		Name:    name,
+		ModTime: epoch,
+		Mode:    0644,
+		Format:  tar.FormatPAX,
+	}
+	if info.IsDir() {
+		h.Typeflag = tar.TypeDir
+		h.Name += "/"
+		h.Mode = 0755
+		return h
+	}
+	h.Typeflag = tar.TypeReg
+	h.Size = info.Size()
+	if info.Mode().Perm()&0111 != 0 {
+		h.Mode = 0755
+	}
+	return h
+}
+
+func copyFile(w io.Writer, fs afero.Fs, name string) error {
+	f, err := fs.Open(name)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("could not copy %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cube
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// SignatureExt is the extension appended to a cube file name to get its detached signature.
+const SignatureExt = ".sig"
+
+// ErrInvalidSignature is returned when a signature does not match a cube.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// Sign returns the detached signature of cube, base64 encoded.
+func Sign(key ed25519.PrivateKey, cube []byte) []byte {
+	sig := ed25519.Sign(key, cube)
+	return []byte(base64.StdEncoding.EncodeToString(sig) + "\n")
+}
+
+// Verify checks sig is a valid signature of cube for key.
+// sig is either base64 encoded, as returned by Sign, or raw
+// (e.g. produced with openssl pkeyutl -sign -rawin).
+func Verify(key ed25519.PublicKey, cube, sig []byte) error {
+	raw := sig
+	if len(sig) != ed25519.SignatureSize {
+		var err error
+		raw, err = base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+		if err != nil {
+			return fmt.Errorf("could not decode signature: %w", err)
+		}
+	}
+	if !ed25519.Verify(key, cube, raw) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ParsePrivateKey parses a PEM encoded PKCS #8 ed25519 private key,
+// as generated by openssl genpkey -algorithm ed25519.
+func ParsePrivateKey(data []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse private key: %w", err)
+	}
+	pk, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T, expecting ed25519", key)
+	}
+	return pk, nil
+}
+
+// ParsePublicKey parses a PEM encoded PKIX ed25519 public key,
+// as generated by openssl pkey -pubout.
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse public key: %w", err)
+	}
+	pk, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type %T, expecting ed25519", key)
+	}
+	return pk, nil
+}
+
+// ReadPrivateKey reads a PEM encoded ed25519 private key from a file.
+func ReadPrivateKey(name string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not read private key: %w", err)
+	}
+	return ParsePrivateKey(data)
+}
+
+// ReadPublicKey reads a PEM encoded ed25519 public key from a file.
+func ReadPublicKey(name string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("could not read public key: %w", err)
+	}
+	return ParsePublicKey(data)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cube
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	data := archive(t, map[string]string{"main.cue": "package main"})
+	sig := Sign(priv, data)
+
+	assert.NoError(t, Verify(pub, data, sig))
+	// raw signature
+	assert.NoError(t, Verify(pub, data, ed25519.Sign(priv, data)))
+	assert.ErrorIs(t, Verify(other, data, sig), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify(pub, append(data, 0), sig), ErrInvalidSignature)
+	assert.Error(t, Verify(pub, data, []byte("not a signature")))
+}
+
+func TestParseKeys(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	b, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	pk, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: b}))
+	assert.NoError(t, err)
+	assert.Equal(t, priv, pk)
+
+	b, err = x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	pubk, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}))
+	assert.NoError(t, err)
+	assert.Equal(t, pub, pubk)
+
+	_, err = ParsePublicKey([]byte("garbage"))
+	assert.ErrorContains(t, err, "no PEM block found")
+	_, err = ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: b}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,197 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/literal"
+)
+
+// refPattern matches the ${<cue path>} references of an @inject attribute.
+var refPattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// injection is an @inject attribute waiting to be injected.
+type injection struct {
+	attr cue.Attribute
+	dst  cue.Path
+	// refs are the paths, from the root, the attribute refers to.
+	refs []cue.Path
+	err  error
+}
+
+func newInjection(attr cue.Attribute, dst cue.Path) *injection {
+	i := &injection{attr: attr, dst: dst}
+	for n := 0; n < attr.NumArgs(); n++ {
+		_, v := attr.Arg(n)
+		for _, m := range refPattern.FindAllStringSubmatch(v, -1) {
+			p := cue.ParsePath(m[1])
+			if err := p.Err(); err != nil {
+				i.err = fmt.Errorf("invalid reference %s: %w", m[0], err)
+				return i
+			}
+			i.refs = append(i.refs, p)
+		}
+	}
+	return i
+}
+
+// dependsOn reports whether i refers to a value j injects, or to a value containing it.
+func (i *injection) dependsOn(j *injection) bool {
+	for _, r := range i.refs {
+		if overlap(r, j.dst) {
+			return true
+		}
+	}
+	return false
+}
+
+// dependsOnAny reports whether i depends on one of the pending injections.
+func dependsOnAny(i *injection, pending []*injection) bool {
+	for _, j := range pending {
+		if i.dependsOn(j) {
+			return true
+		}
+	}
+	return false
+}
+
+// ready reports whether every reference of i can be resolved in v,
+// none of them being injected by a pending injection.
+func (i *injection) ready(v cue.Value, pending []*injection) bool {
+	if i.err != nil {
+		return true
+	}
+	if dependsOnAny(i, pending) {
+		return false
+	}
+	for _, r := range i.refs {
+		if ref := v.LookupPath(r); !ref.Exists() || !ref.IsConcrete() {
+			return false
+		}
+	}
+	return true
+}
+
+// injector returns the Injector of i, once its references are resolved in v.
+func (i *injection) injector(v cue.Value, r *Registry, s *Session) Injector {
+	if i.err != nil {
+		return NewError(i.err, i.dst)
+	}
+	attr, err := i.resolve(v)
+	if err != nil {
+		return NewError(err, i.dst)
+	}
+	return addInjector(attr, i.dst, r, s)
+}
+
+// resolve returns the attribute of i, with its references replaced by their value in v.
+func (i *injection) resolve(v cue.Value) (*cue.Attribute, error) {
+	if len(i.refs) == 0 {
+		return &i.attr, nil
+	}
+
+	args := make([]string, i.attr.NumArgs())
+	for n := range args {
+		k, arg := i.attr.Arg(n)
+		var err error
+		arg = refPattern.ReplaceAllStringFunc(arg, func(ref string) string {
+			s, rerr := scalar(v, cue.ParsePath(ref[2:len(ref)-1]))
+			if rerr != nil && err == nil {
+				err = fmt.Errorf("could not resolve %s: %w", ref, rerr)
+			}
+			return s
+		})
+		if err != nil {
+			return nil, err
+		}
+		args[n] = literal.String.Quote(arg)
+		if k != "" {
+			args[n] = k + "=" + args[n]
+		}
+	}
+
+	a := v.Context().CompileString(fmt.Sprintf("x: _ @inject(%s)", strings.Join(args, ", "))).
+		LookupPath(cue.MakePath(cue.Str("x"))).
+		Attribute("inject")
+	if err := a.Err(); err != nil {
+		return nil, fmt.Errorf("invalid resolved attribute: %w", err)
+	}
+	return &a, nil
+}
+
+// scalar returns the string representation of the concrete scalar at p in v.
+func scalar(v cue.Value, p cue.Path) (string, error) {
+	v = v.LookupPath(p)
+	switch {
+	case !v.Exists():
+		return "", errors.New("field not found")
+	case v.Err() != nil:
+		return "", v.Err()
+	case !v.IsConcrete():
+		return "", errors.New("incomplete value")
+	}
+	switch v.Kind() {
+	case cue.StringKind:
+		return v.String()
+	case cue.BoolKind, cue.IntKind, cue.FloatKind:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("%s is not a string, a number or a bool", v.Kind())
+	}
+}
+
+// cycle returns the dst paths of a dependency cycle going through i, if any.
+func cycle(i *injection, pending []*injection) []string {
+	var visit func(j *injection, path []string, seen map[*injection]bool) []string
+	visit = func(j *injection, path []string, seen map[*injection]bool) []string {
+		for _, k := range pending {
+			if !j.dependsOn(k) {
+				continue
+			}
+			if k == i {
+				return append(path, i.dst.String())
+			}
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			if c := visit(k, append(path, k.dst.String()), seen); c != nil {
+				return c
+			}
+		}
+		return nil
+	}
+	return visit(i, []string{i.dst.String()}, map[*injection]bool{i: true})
+}
+
+// overlap reports whether a and b are the same path, or one is a prefix of the other.
+func overlap(a, b cue.Path) bool {
+	as, bs := a.Selectors(), b.Selectors()
+	if len(as) > len(bs) {
+		as, bs = bs, as
+	}
+	for n, s := range as {
+		if s.String() != bs[n].String() {
+			return false
+		}
+	}
+	return true
+}
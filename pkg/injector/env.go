@@ -0,0 +1,90 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"cuelang.org/go/cue"
+)
+
+// Env injector uses an environment variable as source of the inject value.
+type Env struct {
+	path cue.Path
+	name string
+}
+
+// NewEnv creates a new environment variable injector.
+// Wrap it in an Optional injector to inject a default value when the variable is not set.
+func NewEnv(name string, dstPath cue.Path) *Env {
+	return &Env{path: dstPath, name: name}
+}
+
+// Inject returns the target value after injection.
+// The variable is converted to the kind of the target value (int, float, number or bool),
+// unless it accepts strings.
+func (e *Env) Inject(target cue.Value) cue.Value {
+	return target.FillPath(e.path, e.value(target))
+}
+
+func (e *Env) value(target cue.Value) interface{} {
+	s, ok := os.LookupEnv(e.name)
+	if !ok {
+		return NewError(notFound("environment variable %s is not set", e.name), e.path)
+	}
+
+	v, err := coerce(s, target.LookupPath(e.path).IncompleteKind())
+	if err != nil {
+		return NewError(fmt.Errorf("could not convert %s: %w", e.name, err), e.path)
+	}
+	return v
+}
+
+// coerce converts s to the given kind.
+// s is returned as is if kind accepts strings or is not a scalar kind.
+func coerce(s string, kind cue.Kind) (interface{}, error) {
+	switch {
+	case kind&cue.StringKind != 0:
+		return s, nil
+	case kind == cue.BoolKind:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a bool", s)
+		}
+		return b, nil
+	case kind&cue.NumberKind == cue.IntKind:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an int", s)
+		}
+		return i, nil
+	case kind&cue.NumberKind != 0:
+		if kind&cue.IntKind != 0 {
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i, nil
+			}
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", s)
+		}
+		return f, nil
+	default:
+		return s, nil
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvInject(t *testing.T) {
+	t.Setenv("CUEBE_TAG", "v1.2.3")
+	t.Setenv("CUEBE_REPLICAS", "3")
+	t.Setenv("CUEBE_RATIO", "0.5")
+	t.Setenv("CUEBE_DEBUG", "true")
+
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`
+tag:      string
+replicas: int
+ratio:    number
+count:    number
+debug:    bool
+any:      _
+`)
+	def := "fallback"
+	for _, e := range []Injector{
+		NewEnv("CUEBE_TAG", cue.ParsePath("tag")),
+		NewEnv("CUEBE_REPLICAS", cue.ParsePath("replicas")),
+		NewEnv("CUEBE_RATIO", cue.ParsePath("ratio")),
+		NewEnv("CUEBE_REPLICAS", cue.ParsePath("count")),
+		NewEnv("CUEBE_DEBUG", cue.ParsePath("debug")),
+		NewOptional(NewEnv("CUEBE_UNSET", cue.ParsePath("any")), &def, cue.ParsePath("any")),
+	} {
+		v = e.Inject(v)
+	}
+	assert.NoError(t, v.Err())
+	actual, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"tag":"v1.2.3","replicas":3,"ratio":0.5,"count":3,"debug":true,"any":"fallback"}`, string(actual))
+}
+
+func TestEnvInjectError(t *testing.T) {
+	t.Setenv("CUEBE_TAG", "v1.2.3")
+	ctx := cuecontext.New()
+
+	v := NewEnv("CUEBE_UNSET", cue.ParsePath("foo")).Inject(ctx.CompileString("foo: string"))
+	assert.EqualError(t, v.Err(), "injection error: environment variable CUEBE_UNSET is not set")
+
+	v = NewEnv("CUEBE_TAG", cue.ParsePath("foo")).Inject(ctx.CompileString("foo: int"))
+	assert.EqualError(t, v.Err(), `injection error: could not convert CUEBE_TAG: "v1.2.3" is not an int`)
+
+	v = NewEnv("CUEBE_TAG", cue.ParsePath("foo")).Inject(ctx.CompileString("foo: bool"))
+	assert.EqualError(t, v.Err(), `injection error: could not convert CUEBE_TAG: "v1.2.3" is not a bool`)
+}
@@ -16,6 +16,7 @@ limitations under the License.
 package injector
 
 import (
+	"errors"
 	"fmt"
 
 	"cuelang.org/go/cue"
@@ -40,3 +41,30 @@ func (e *Error) Inject(target cue.Value) cue.Value {
 func (e *Error) Error() string {
 	return fmt.Sprintf("injection error: %v", e.err)
 }
+
+// Unwrap returns the cause of the injection error.
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// ErrNotFound is matched by the errors of the injections whose source is absent,
+// e.g. an unset environment variable, a glob matching no file or a path matching nothing.
+// Missing files match fs.ErrNotExist instead.
+var ErrNotFound = errors.New("not found")
+
+// notFoundError is an error matching ErrNotFound, with its own message.
+type notFoundError struct {
+	msg string
+}
+
+func notFound(format string, a ...interface{}) error {
+	return &notFoundError{msg: fmt.Sprintf(format, a...)}
+}
+
+func (e *notFoundError) Error() string {
+	return e.msg
+}
+
+func (e *notFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
@@ -0,0 +1,89 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"cuelang.org/go/cue"
+)
+
+// Exec injector uses the standard output of a local command as source of the inject value.
+type Exec struct {
+	path   cue.Path
+	result chan interface{}
+}
+
+// NewExec creates a new exec injector, running name with args, once pool has a worker available, until ctx is done.
+// format is the output format (json, yaml, toml, env, properties, cue or text).
+// If empty, the output is parsed as YAML, a superset of JSON, when srcPath is set,
+// and injected as plain text otherwise.
+// The trailing newline of a plain text output is removed.
+func NewExec(ctx context.Context, name string, args []string, srcPath, format string, dstPath cue.Path, pool *Pool) *Exec {
+	r := make(chan interface{}, 1)
+	pool.run(dstPath, name, func() { runExec(ctx, name, args, srcPath, format, r) })
+	return &Exec{path: dstPath, result: r}
+}
+
+// Inject returns the target value after injection.
+func (e *Exec) Inject(target cue.Value) cue.Value {
+	return target.FillPath(e.path, e.value(target))
+}
+
+func (e *Exec) value(cue.Value) interface{} {
+	return <-e.result
+}
+
+func runExec(ctx context.Context, name string, args []string, jpath, format string, res chan<- interface{}) {
+	defer close(res)
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		res <- fmt.Errorf("failed to run %s: %w", name, err)
+		return
+	}
+
+	b := stdout.Bytes()
+	ext := "." + format
+	switch format {
+	case "text":
+		jpath = ""
+	case "":
+		ext = ".yaml"
+	}
+	if jpath == "" {
+		b = bytes.TrimSuffix(bytes.TrimSuffix(b, []byte("\n")), []byte("\r"))
+	}
+
+	v, err := extract(b, ext, jpath)
+	if err != nil {
+		res <- err
+		return
+	}
+	res <- v
+}
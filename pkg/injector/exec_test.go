@@ -0,0 +1,90 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/loft-orbital/cuebe/pkg/sensitive"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecInject(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping shell related test on windows")
+	}
+
+	ctx := cuecontext.New()
+	v := ctx.CompileString("text: _, json: _, yaml: _, raw: _")
+	for _, e := range []*Exec{
+		NewExec(context.Background(), "echo", []string{"s3cr3t"}, "", "", cue.ParsePath("text"), nil),
+		NewExec(context.Background(), "echo", []string{`{"db": {"password": "hunter2"}}`}, "$.db.password", "", cue.ParsePath("json"), nil),
+		NewExec(context.Background(), "printf", []string{"port: 5432\n"}, "$.port", "yaml", cue.ParsePath("yaml"), nil),
+		NewExec(context.Background(), "printf", []string{"a: 1\n"}, "$.a", "text", cue.ParsePath("raw"), nil),
+	} {
+		v = e.Inject(v)
+	}
+	require.NoError(t, v.Err())
+	actual, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"text": "s3cr3t", "json": "hunter2", "yaml": 5432, "raw": "a: 1"}`, string(actual))
+
+	foo := ctx.CompileString("foo: _")
+	v = NewExec(context.Background(), "sh", []string{"-c", "echo denied >&2; exit 3"}, "", "", cue.ParsePath("foo"), nil).Inject(foo)
+	assert.EqualError(t, v.Err(), "failed to run sh: exit status 3: denied")
+
+	v = NewExec(context.Background(), "cuebe-does-not-exist", nil, "", "", cue.ParsePath("foo"), nil).Inject(foo)
+	assert.ErrorContains(t, v.Err(), "failed to run cuebe-does-not-exist: exec: \"cuebe-does-not-exist\": executable file not found")
+
+	tctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	v = NewExec(tctx, "sleep", []string{"5"}, "", "", cue.ParsePath("foo"), nil).Inject(foo)
+	assert.EqualError(t, v.Err(), "failed to run sleep: context deadline exceeded")
+}
+
+func TestInjectExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("skipping shell related test on windows")
+	}
+
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`
+password: string @inject(type=exec, cmd=echo, args="db password", arg="with spaces")
+user: string @inject(type=exec, cmd=printf, arg="user: admin", path=$.user, sensitive=false)
+`)
+
+	sens := sensitive.NewPaths()
+	actual := InjectWith(v, Options{AllowExec: []string{"echo", "printf"}, Sensitive: sens})
+	require.NoError(t, actual.Err())
+	json, err := actual.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"password": "db password with spaces", "user": "admin"}`, string(json))
+	assert.Equal(t, []cue.Path{cue.ParsePath("password")}, sens.List())
+
+	actual = InjectWith(v, Options{AllowExec: []string{"echo"}})
+	assert.EqualError(t, actual.Err(), "injection error: executable printf is not allowed")
+	actual = Inject(v, nil)
+	assert.EqualError(t, actual.Err(), "injection error: executable echo is not allowed")
+
+	v = ctx.CompileString("foo: _ @inject(type=exec)")
+	assert.EqualError(t, Inject(v, nil).Err(), "injection error: missing cmd key for exec injector")
+}
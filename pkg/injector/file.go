@@ -16,15 +16,20 @@ limitations under the License.
 package injector
 
 import (
-	"encoding/json"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io/fs"
 	"path"
+	"strings"
+	"sync"
 
 	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
+	"cuelang.org/go/cue/cuecontext"
 	"github.com/PaesslerAG/jsonpath"
 	"github.com/loft-orbital/cuebe/pkg/unifier"
-	"gopkg.in/yaml.v3"
 )
 
 // File injector uses a local file as source of the inject value.
@@ -34,54 +39,359 @@ type File struct {
 }
 
 // NewFile creates a new file injector.
-func NewFile(src, srcPath string, dstPath cue.Path, fs fs.FS) *File {
+// srcPath selects the injected value: a JSONPath expression, starting with $, or a CUE path.
+// If empty, the file is injected as plain text.
+// Files are shared through cache, if not nil, and read once pool has a worker available.
+func NewFile(src, srcPath string, dstPath cue.Path, fs fs.FS, cache *FileCache, pool *Pool) *File {
 	r := make(chan interface{}, 1)
-	go parseFile(src, srcPath, fs, r)
+	pool.run(dstPath, src, func() { parseFile(src, srcPath, fs, cache, r) })
 	return &File{path: dstPath, result: r}
 }
 
 // Inject returns the target value after injection.
 func (f *File) Inject(target cue.Value) cue.Value {
-	r := <-f.result
-	return target.FillPath(f.path, r)
+	return target.FillPath(f.path, f.value(target))
 }
 
-func parseFile(file, jpath string, fs fs.FS, res chan<- interface{}) {
+func (f *File) value(cue.Value) interface{} {
+	return <-f.result
+}
+
+// Encoding defines how the raw content of a file is injected.
+type Encoding string
+
+const (
+	// EncodingBase64 injects the standard base64 encoding of the content, as expected by Secret.data.
+	EncodingBase64 Encoding = "base64"
+	// EncodingHex injects the hexadecimal encoding of the content.
+	EncodingHex Encoding = "hex"
+	// EncodingRaw injects the content as CUE bytes.
+	EncodingRaw Encoding = "raw"
+)
+
+// ParseEncoding returns the Encoding named s.
+func ParseEncoding(s string) (Encoding, error) {
+	switch e := Encoding(s); e {
+	case EncodingBase64, EncodingHex, EncodingRaw:
+		return e, nil
+	default:
+		return "", fmt.Errorf("unsupported encoding %s, expecting base64, hex or raw", s)
+	}
+}
+
+// NewEncodedFile creates a new file injector, injecting the whole file content with the given encoding.
+// Encrypted files are decrypted first.
+func NewEncodedFile(src string, enc Encoding, dstPath cue.Path, fs fs.FS, cache *FileCache, pool *Pool) *File {
+	r := make(chan interface{}, 1)
+	pool.run(dstPath, src, func() { encodeFile(src, enc, fs, cache, r) })
+	return &File{path: dstPath, result: r}
+}
+
+func encodeFile(file string, enc Encoding, fs fs.FS, cache *FileCache, res chan<- interface{}) {
 	defer close(res)
 
-	// read
-	b, err := unifier.ReadFile(file, fs)
+	v, err := fileValue(file, "", enc, fs, cache)
 	if err != nil {
-		res <- fmt.Errorf("failed to read %s: %w", file, err)
+		res <- err
 		return
 	}
+	res <- v
+}
 
-	var v interface{}
+// NewGlob creates a new file injector, injecting a struct mapping the base name
+// of every file matching pattern to its value, extracted at srcPath or encoded with enc, if set.
+// If pattern is a directory, every file it directly contains is injected.
+func NewGlob(pattern, srcPath string, enc Encoding, dstPath cue.Path, fs fs.FS, cache *FileCache, pool *Pool) *File {
+	r := make(chan interface{}, 1)
+	pool.run(dstPath, pattern, func() { globFiles(pattern, srcPath, enc, fs, cache, r) })
+	return &File{path: dstPath, result: r}
+}
 
-	if jpath == "" {
-		// plain text injection
-		v = string(b)
-	} else {
-		// structured injection
-		switch path.Ext(file) {
-		case ".json":
-			err = json.Unmarshal(b, &v)
-		case ".yaml", ".yml":
-			err = yaml.Unmarshal(b, &v)
-		default:
-			err = fmt.Errorf("Unsupported extension %s", path.Ext(file))
+// IsGlob reports whether src is a glob pattern rather than a file name.
+func IsGlob(src string) bool {
+	return strings.ContainsAny(src, "*?[")
+}
+
+func globFiles(pattern, jpath string, enc Encoding, fsys fs.FS, cache *FileCache, res chan<- interface{}) {
+	defer close(res)
+
+	names, err := matches(pattern, fsys)
+	if err != nil {
+		res <- err
+		return
+	}
+
+	ctx := cuecontext.New()
+	seen := make(map[string]bool, len(names))
+	st := &ast.StructLit{}
+	for _, name := range names {
+		if info, err := fs.Stat(fsys, name); err != nil || info.IsDir() {
+			continue
+		}
+		key := path.Base(name)
+		if seen[key] {
+			res <- fmt.Errorf("several files matching %s are named %s", pattern, key)
+			return
 		}
+		seen[key] = true
+		v, err := fileValue(name, jpath, enc, fsys, cache)
 		if err != nil {
-			res <- fmt.Errorf("failed to unmarshal: %w", err)
+			res <- err
 			return
 		}
-
-		v, err = jsonpath.Get(jpath, v)
+		expr, err := toExpr(ctx, v)
 		if err != nil {
-			res <- fmt.Errorf("failed to extract path: %w", err)
+			res <- err
 			return
 		}
+		st.Elts = append(st.Elts, &ast.Field{Label: ast.NewString(key), Value: expr})
+	}
+	if len(st.Elts) == 0 {
+		res <- notFound("no file matches %s", pattern)
+		return
+	}
+	res <- st
+}
+
+// matches returns the names of the files matching pattern, or contained in the pattern directory.
+func matches(pattern string, fsys fs.FS) ([]string, error) {
+	if IsGlob(pattern) {
+		names, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to match %s: %w", pattern, err)
+		}
+		return names, nil
+	}
+
+	entries, err := fs.ReadDir(fsys, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", pattern, err)
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, path.Join(pattern, e.Name()))
+	}
+	return names, nil
+}
+
+func parseFile(file, jpath string, fs fs.FS, cache *FileCache, res chan<- interface{}) {
+	defer close(res)
+
+	v, err := fileValue(file, jpath, "", fs, cache)
+	if err != nil {
+		res <- err
+		return
 	}
 
 	res <- v
 }
+
+// fileValue returns the value to inject from file:
+// its content encoded with enc if set, the value at jpath otherwise.
+func fileValue(file, jpath string, enc Encoding, fs fs.FS, cache *FileCache) (interface{}, error) {
+	// read
+	b, err := cache.content(file, fs)
+	if err != nil {
+		return nil, err
+	}
+
+	switch enc {
+	case EncodingBase64:
+		return base64.StdEncoding.EncodeToString(b), nil
+	case EncodingHex:
+		return hex.EncodeToString(b), nil
+	case EncodingRaw:
+		return b, nil
+	}
+	if jpath == "" {
+		// plain text injection
+		return string(b), nil
+	}
+
+	// structured injection
+	doc := cache.document(file, path.Ext(file), b)
+	doc.mu.Lock()
+	defer doc.mu.Unlock()
+	if doc.err != nil {
+		return nil, doc.err
+	}
+	return selectValue(doc.value, jpath)
+}
+
+// extract returns the value sel selects in b, a document in the format of the ext file extension.
+// sel is either a JSONPath expression, starting with $, or a CUE path.
+// If sel is empty, b is returned as plain text.
+// Selected values are returned as CUE expressions, keeping their types.
+func extract(b []byte, ext, sel string) (interface{}, error) {
+	if sel == "" {
+		// plain text injection
+		return string(b), nil
+	}
+
+	// structured injection
+	v, err := decodeDocument(cuecontext.New(), b, ext)
+	if err != nil {
+		return nil, err
+	}
+	return selectValue(v, sel)
+}
+
+// decodeDocument returns the CUE value of b, a document in the format of the ext file extension.
+func decodeDocument(ctx *cue.Context, b []byte, ext string) (cue.Value, error) {
+	v, err := decode(ctx, b, ext)
+	if err == nil {
+		err = v.Err()
+	}
+	if err != nil {
+		return cue.Value{}, fmt.Errorf("failed to unmarshal: %w", err)
+	}
+	return v, nil
+}
+
+// selectValue returns the value sel selects in v, as a CUE expression.
+// sel is either a JSONPath expression, starting with $, or a CUE path.
+func selectValue(v cue.Value, sel string) (ast.Expr, error) {
+	if isJSONPath(sel) {
+		var doc interface{}
+		if err := v.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode: %w", err)
+		}
+		eval, err := jsonpath.New(sel)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %s: %w", sel, err)
+		}
+		x, err := eval(context.Background(), doc)
+		if err != nil && isMissing(err) {
+			return nil, notFound("failed to extract path: %v", err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract path: %w", err)
+		}
+		v = v.Context().Encode(x)
+	} else {
+		p := cue.ParsePath(sel)
+		if err := p.Err(); err != nil {
+			return nil, fmt.Errorf("invalid cue path %s: %w", sel, err)
+		}
+		sels := p.Selectors()
+		for i, s := range sels {
+			if k := v.IncompleteKind(); k != cue.StructKind && k != cue.ListKind {
+				return nil, fmt.Errorf("failed to extract path: %s is a %s", cue.MakePath(sels[:i]...), k)
+			}
+			if v = v.LookupPath(cue.MakePath(s)); !v.Exists() {
+				return nil, notFound("failed to extract path: %s not found", sel)
+			}
+		}
+	}
+	return syntax(v)
+}
+
+// isMissing reports whether err, a JSONPath evaluation error, comes from an absent key or index,
+// rather than from a value of the wrong type.
+func isMissing(err error) bool {
+	msg := err.Error()
+	return strings.HasPrefix(msg, "unknown key ") ||
+		strings.HasPrefix(msg, "index ") && strings.HasSuffix(msg, " out of bounds")
+}
+
+// isJSONPath reports whether sel is a JSONPath expression rather than a CUE path.
+func isJSONPath(sel string) bool {
+	return sel == "$" || strings.HasPrefix(sel, "$.") || strings.HasPrefix(sel, "$[")
+}
+
+// syntax returns v as a CUE expression, so that it can be injected in a value of another runtime.
+func syntax(v cue.Value) (ast.Expr, error) {
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	switch n := v.Syntax(cue.Final()).(type) {
+	case *ast.File:
+		return &ast.StructLit{Elts: n.Decls}, nil
+	case ast.Expr:
+		return n, nil
+	default:
+		return nil, fmt.Errorf("unexpected syntax %T", n)
+	}
+}
+
+// toExpr returns x, a value to inject, as a CUE expression.
+func toExpr(ctx *cue.Context, x interface{}) (ast.Expr, error) {
+	if e, ok := x.(ast.Expr); ok {
+		return e, nil
+	}
+	return syntax(ctx.Encode(x))
+}
+
+// FileCache holds the files read by file injections.
+// It makes sure a given file is only read, and decrypted, once and decoded once per format,
+// even by concurrent injectors.
+type FileCache struct {
+	mu    sync.Mutex
+	files map[fileKey]*cachedFile
+}
+
+// fileKey identifies a cached file by its name and the format it is decoded from,
+// empty for its raw content.
+type fileKey struct {
+	src, format string
+}
+
+type cachedFile struct {
+	once sync.Once
+	// mu guards value, since its context is not safe for concurrent use
+	mu    sync.Mutex
+	b     []byte
+	value cue.Value
+	err   error
+}
+
+// NewFileCache returns an empty FileCache.
+func NewFileCache() *FileCache {
+	return &FileCache{files: make(map[fileKey]*cachedFile)}
+}
+
+// get returns the cached file of key, filling it with fill the first time. A nil cache always fills it.
+func (c *FileCache) get(key fileKey, fill func(*cachedFile)) *cachedFile {
+	if c == nil {
+		f := new(cachedFile)
+		fill(f)
+		return f
+	}
+
+	c.mu.Lock()
+	f, ok := c.files[key]
+	if !ok {
+		f = new(cachedFile)
+		c.files[key] = f
+	}
+	c.mu.Unlock()
+
+	f.once.Do(func() { fill(f) })
+	return f
+}
+
+// ReadFile returns the content of file, decrypted, only reading it from fsys the first time.
+// A nil cache always reads it.
+func (c *FileCache) ReadFile(file string, fsys fs.FS) ([]byte, error) {
+	f := c.get(fileKey{src: file}, func(f *cachedFile) {
+		f.b, f.err = unifier.ReadFile(file, fsys)
+	})
+	return f.b, f.err
+}
+
+// content returns the content of file, decrypted.
+func (c *FileCache) content(file string, fsys fs.FS) ([]byte, error) {
+	b, err := c.ReadFile(file, fsys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	return b, nil
+}
+
+// document returns file decoded from b, its content, in the format of the ext file extension.
+// Its mu must be held while using its value.
+func (c *FileCache) document(file, ext string, b []byte) *cachedFile {
+	return c.get(fileKey{src: file, format: ext}, func(f *cachedFile) {
+		f.value, f.err = decodeDocument(cuecontext.New(), b, ext)
+	})
+}
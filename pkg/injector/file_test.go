@@ -17,13 +17,19 @@ package injector
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path"
 	"runtime"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/ast"
 	"cuelang.org/go/cue/cuecontext"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -49,9 +55,14 @@ func TestParseFile(t *testing.T) {
 	b, _ := json.Marshal(Spacecraft{"Voyager", 470, 1})
 	f.Write(b)
 	res := make(chan interface{})
-	go parseFile(path.Base(f.Name()), "$.power", fsys, res)
+	go parseFile(path.Base(f.Name()), "$.power", fsys, nil, res)
 
-	assert.Equal(t, float64(470), <-res)
+	// injected as a typed CUE value
+	v := cuecontext.New().BuildExpr((<-res).(ast.Expr))
+	assert.Equal(t, cue.IntKind, v.Kind())
+	power, err := v.Int64()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(470), power)
 
 	// plain
 	f, err = ioutil.TempFile("", "test_inject*.plain")
@@ -62,7 +73,7 @@ func TestParseFile(t *testing.T) {
 
 	f.WriteString("hello cuebe!")
 	res = make(chan interface{})
-	go parseFile(path.Base(f.Name()), "", fsys, res)
+	go parseFile(path.Base(f.Name()), "", fsys, nil, res)
 
 	// r = <-res
 	assert.Equal(t, "hello cuebe!", <-res)
@@ -84,10 +95,153 @@ func TestInject(t *testing.T) {
 
 	b, _ := json.Marshal(Spacecraft{"Voyager", 470, 1})
 	f.Write(b)
-	fi := NewFile(path.Base(f.Name()), "$.name", cue.ParsePath("spacecraft.name"), fsys)
+	fi := NewFile(path.Base(f.Name()), "$.name", cue.ParsePath("spacecraft.name"), fsys, nil, nil)
 	v = fi.Inject(v)
 
 	actual, err := v.MarshalJSON()
 	assert.NoError(t, err)
 	assert.Equal(t, `{"spacecraft":{"name":"Voyager"}}`, string(actual))
 }
+
+func TestEncodedFileInject(t *testing.T) {
+	bin := []byte{0xca, 0xfe, 0x00, 0xff}
+	fsys := fstest.MapFS{"keystore.p12": {Data: bin}}
+	ctx := cuecontext.New()
+
+	v := ctx.CompileString("b64: string, hex: string, raw: bytes")
+	for _, f := range []*File{
+		NewEncodedFile("keystore.p12", EncodingBase64, cue.ParsePath("b64"), fsys, nil, nil),
+		NewEncodedFile("keystore.p12", EncodingHex, cue.ParsePath("hex"), fsys, nil, nil),
+		NewEncodedFile("keystore.p12", EncodingRaw, cue.ParsePath("raw"), fsys, nil, nil),
+	} {
+		v = f.Inject(v)
+	}
+	require.NoError(t, v.Err())
+	actual, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"b64":"yv4A/w==","hex":"cafe00ff","raw":"yv4A/w=="}`, string(actual))
+	raw, err := v.LookupPath(cue.ParsePath("raw")).Bytes()
+	assert.NoError(t, err)
+	assert.Equal(t, bin, raw)
+
+	v = NewEncodedFile("missing", EncodingRaw, cue.ParsePath("raw"), fsys, nil, nil).Inject(v)
+	assert.ErrorContains(t, v.Err(), "failed to read missing")
+}
+
+func TestParseEncoding(t *testing.T) {
+	for _, e := range []Encoding{EncodingBase64, EncodingHex, EncodingRaw} {
+		actual, err := ParseEncoding(string(e))
+		assert.NoError(t, err)
+		assert.Equal(t, e, actual)
+	}
+	_, err := ParseEncoding("rot13")
+	assert.EqualError(t, err, "unsupported encoding rot13, expecting base64, hex or raw")
+}
+
+func TestGlobInject(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dashboards/cpu.json":       {Data: []byte(`{"title": "CPU"}`)},
+		"dashboards/memory.json":    {Data: []byte(`{"title": "Memory"}`)},
+		"dashboards/README.md":      {Data: []byte("# Dashboards")},
+		"dashboards/nested/io.json": {Data: []byte(`{"title": "IO"}`)},
+		"other/cpu.json":            {Data: []byte(`{"title": "Other CPU"}`)},
+	}
+	ctx := cuecontext.New()
+	v := ctx.CompileString("titles: _, raw: _, dir: _, encoded: _")
+	for _, f := range []*File{
+		NewGlob("dashboards/*.json", "$.title", "", cue.ParsePath("titles"), fsys, nil, nil),
+		NewGlob("dashboards/c*.json", "", "", cue.ParsePath("raw"), fsys, nil, nil),
+		NewGlob("dashboards", "", "", cue.ParsePath("dir"), fsys, nil, nil),
+		NewGlob("dashboards/m*", "", EncodingHex, cue.ParsePath("encoded"), fsys, nil, nil),
+	} {
+		v = f.Inject(v)
+	}
+	require.NoError(t, v.Err())
+	actual, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"titles": {"cpu.json": "CPU", "memory.json": "Memory"},
+		"raw": {"cpu.json": "{\"title\": \"CPU\"}"},
+		"dir": {"cpu.json": "{\"title\": \"CPU\"}", "memory.json": "{\"title\": \"Memory\"}", "README.md": "# Dashboards"},
+		"encoded": {"memory.json": "7b227469746c65223a20224d656d6f7279227d"}
+	}`, string(actual))
+
+	foo := ctx.CompileString("foo: _")
+	v = NewGlob("*/cpu.json", "", "", cue.ParsePath("foo"), fsys, nil, nil).Inject(foo)
+	assert.EqualError(t, v.Err(), "several files matching */cpu.json are named cpu.json")
+	v = NewGlob("*.yaml", "", "", cue.ParsePath("foo"), fsys, nil, nil).Inject(foo)
+	assert.EqualError(t, v.Err(), "no file matches *.yaml")
+	v = NewGlob("dashboards/*.md", "$.title", "", cue.ParsePath("foo"), fsys, nil, nil).Inject(foo)
+	assert.ErrorContains(t, v.Err(), "Unsupported extension .md")
+}
+
+// countFS counts the files opened, and the maximum of files open concurrently.
+type countFS struct {
+	fs.FS
+	mu         sync.Mutex
+	opens      map[string]int
+	open, peak int
+}
+
+func (c *countFS) Open(name string) (fs.File, error) {
+	c.mu.Lock()
+	c.opens[name]++
+	c.open++
+	if c.open > c.peak {
+		c.peak = c.open
+	}
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		c.open--
+		c.mu.Unlock()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	return c.FS.Open(name)
+}
+
+func TestFileCache(t *testing.T) {
+	fsys := &countFS{
+		FS: fstest.MapFS{
+			"db.json": {Data: []byte(`{"user": "admin", "password": "hunter2"}`)},
+			"a.txt":   {Data: []byte("a")},
+			"b.txt":   {Data: []byte("b")},
+			"c.txt":   {Data: []byte("c")},
+		},
+		opens: make(map[string]int),
+	}
+	cache := NewFileCache()
+	pool := NewPool(2, nil)
+
+	ctx := cuecontext.New()
+	v := ctx.CompileString("{}")
+	var injectors []*File
+	for i := 0; i < 20; i++ {
+		injectors = append(injectors, NewFile("db.json", "$.password", cue.ParsePath(fmt.Sprintf("password%d", i)), fsys, cache, pool))
+	}
+	injectors = append(injectors,
+		NewFile("db.json", "user", cue.ParsePath("user"), fsys, cache, pool),
+		NewFile("db.json", "", cue.ParsePath("raw"), fsys, cache, pool),
+		NewEncodedFile("db.json", EncodingHex, cue.ParsePath("hex"), fsys, cache, pool),
+		NewFile("a.txt", "", cue.ParsePath("a"), fsys, cache, pool),
+		NewFile("b.txt", "", cue.ParsePath("b"), fsys, cache, pool),
+		NewFile("c.txt", "", cue.ParsePath("c"), fsys, cache, pool),
+		NewFile("missing.json", "$.a", cue.ParsePath("missing"), fsys, cache, pool),
+	)
+	for _, f := range injectors[:len(injectors)-1] {
+		v = f.Inject(v)
+	}
+	require.NoError(t, v.Err())
+	password, _ := v.LookupPath(cue.ParsePath("password19")).String()
+	assert.Equal(t, "hunter2", password)
+	user, _ := v.LookupPath(cue.ParsePath("user")).String()
+	assert.Equal(t, "admin", user)
+
+	v = injectors[len(injectors)-1].Inject(v)
+	assert.ErrorContains(t, v.Err(), "failed to read missing.json")
+
+	// every file is read once, by at most 2 workers at a time
+	assert.Equal(t, map[string]int{"db.json": 1, "a.txt": 1, "b.txt": 1, "c.txt": 1, "missing.json": 1}, fsys.opens)
+	assert.LessOrEqual(t, fsys.peak, 2)
+}
@@ -0,0 +1,205 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/encoding/json"
+	"cuelang.org/go/encoding/yaml"
+	"github.com/BurntSushi/toml"
+	"github.com/loft-orbital/cuebe/internal/utils"
+)
+
+// decode returns the CUE value of b, a document in the format of the ext file extension:
+// .json, .yaml, .yml, .toml, .env (dotenv), .properties or .cue.
+func decode(ctx *cue.Context, b []byte, ext string) (cue.Value, error) {
+	name := "document" + ext
+	switch ext {
+	case ".json":
+		expr, err := json.Extract(name, b)
+		if err != nil {
+			return cue.Value{}, err
+		}
+		return ctx.BuildExpr(expr), nil
+	case ".yaml", ".yml":
+		f, err := yaml.Extract(name, b)
+		if err != nil {
+			return cue.Value{}, err
+		}
+		return ctx.BuildFile(f), nil
+	case ".toml":
+		m := make(map[string]interface{})
+		if err := toml.Unmarshal(b, &m); err != nil {
+			return cue.Value{}, err
+		}
+		return ctx.Encode(m), nil
+	case ".env":
+		m, err := parseDotenv(b)
+		if err != nil {
+			return cue.Value{}, err
+		}
+		return ctx.Encode(m), nil
+	case ".properties":
+		m, err := parseProperties(b)
+		if err != nil {
+			return cue.Value{}, err
+		}
+		return ctx.Encode(m), nil
+	case ".cue":
+		return ctx.CompileBytes(b, cue.Filename(name)), nil
+	default:
+		return cue.Value{}, fmt.Errorf("Unsupported extension %s", ext)
+	}
+}
+
+// parseDotenv parses a dotenv document: KEY=VALUE lines, optionally prefixed by export.
+// Values can be single quoted (literal), double quoted (with \n, \", \\ escapes) or bare,
+// a bare value ending at the first # preceded by a space.
+func parseDotenv(b []byte) (map[string]string, error) {
+	m := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		k, v, ok := utils.Cut(line, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("line %d: expecting KEY=VALUE", n)
+		}
+		v = strings.TrimSpace(v)
+
+		switch {
+		case len(v) >= 2 && v[0] == '\'' && v[len(v)-1] == '\'':
+			v = v[1 : len(v)-1]
+		case len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"':
+			v = strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(v[1 : len(v)-1])
+		default:
+			if i := strings.Index(v, " #"); i >= 0 {
+				v = strings.TrimSpace(v[:i])
+			}
+		}
+		m[k] = v
+	}
+	return m, s.Err()
+}
+
+// parseProperties parses a Java .properties document.
+// Keys are kept flat: a.b=c gives the "a.b" key.
+func parseProperties(b []byte) (map[string]string, error) {
+	m := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(b))
+	logical := ""
+	for s.Scan() {
+		line := strings.TrimLeft(s.Text(), " \t\f")
+		if logical == "" && (line == "" || line[0] == '#' || line[0] == '!') {
+			continue
+		}
+		// an odd number of trailing backslashes continues the line
+		trailing := len(line) - len(strings.TrimRight(line, `\`))
+		if trailing%2 == 1 {
+			logical += line[:len(line)-1]
+			continue
+		}
+		logical += line
+
+		if err := addProperty(m, logical); err != nil {
+			return nil, err
+		}
+		logical = ""
+	}
+	if logical != "" {
+		if err := addProperty(m, logical); err != nil {
+			return nil, err
+		}
+	}
+	return m, s.Err()
+}
+
+// addProperty adds the property of a logical line to m.
+func addProperty(m map[string]string, line string) error {
+	k, v := splitProperty(line)
+	key, err := unescapeProperty(k)
+	if err != nil {
+		return err
+	}
+	m[key], err = unescapeProperty(v)
+	return err
+}
+
+// splitProperty splits a logical line on the first unescaped =, : or whitespace.
+func splitProperty(line string) (key, value string) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '=', ':':
+			return line[:i], strings.TrimLeft(line[i+1:], " \t\f")
+		case ' ', '\t', '\f':
+			value = strings.TrimLeft(line[i:], " \t\f")
+			if value != "" && (value[0] == '=' || value[0] == ':') {
+				value = strings.TrimLeft(value[1:], " \t\f")
+			}
+			return line[:i], value
+		}
+	}
+	return line, ""
+}
+
+func unescapeProperty(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	b := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+5 > len(s) {
+				return "", fmt.Errorf("invalid unicode escape in %q", s)
+			}
+			r, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+			if err != nil {
+				return "", fmt.Errorf("invalid unicode escape in %q", s)
+			}
+			b.WriteRune(rune(r))
+			i += 4
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,104 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"testing"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	tcs := []struct {
+		desc string
+		ext  string
+		doc  string
+		json string
+	}{
+		{"json", ".json", `{"a": {"b": 1, "c": 1.5, "d": true}}`, `{"a":{"b":1,"c":1.5,"d":true}}`},
+		{"yaml", ".yml", "a:\n  b: 1\n  c: [x, y]\n", `{"a":{"b":1,"c":["x","y"]}}`},
+		{"toml", ".toml", "[a]\nb = 1\nc = \"x\"\n", `{"a":{"b":1,"c":"x"}}`},
+		{"dotenv", ".env", "A=1\nexport B='x y'\n", `{"A":"1","B":"x y"}`},
+		{"properties", ".properties", "a.b=1\n", `{"a.b":"1"}`},
+		{"cue", ".cue", "a: b: 1 + 1", `{"a":{"b":2}}`},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.desc, func(t *testing.T) {
+			v, err := decode(cuecontext.New(), []byte(tc.doc), tc.ext)
+			require.NoError(t, err)
+			json, err := v.MarshalJSON()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.json, string(json))
+		})
+	}
+
+	_, err := decode(cuecontext.New(), []byte("a"), ".ini")
+	assert.EqualError(t, err, "Unsupported extension .ini")
+}
+
+func TestParseDotenv(t *testing.T) {
+	m, err := parseDotenv([]byte(`
+# comment
+export HOST=db.local
+PORT = 5432
+NAME=app # trailing comment
+PASSWORD='p#ss'
+MOTD="hello\n\"world\""
+EMPTY=
+`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"HOST":     "db.local",
+		"PORT":     "5432",
+		"NAME":     "app",
+		"PASSWORD": "p#ss",
+		"MOTD":     "hello\n\"world\"",
+		"EMPTY":    "",
+	}, m)
+
+	_, err = parseDotenv([]byte("A=1\nB\n"))
+	assert.EqualError(t, err, "line 2: expecting KEY=VALUE")
+}
+
+func TestParseProperties(t *testing.T) {
+	m, err := parseProperties([]byte(`
+# comment
+! comment
+db.host = db.local
+db.port:5432
+name app
+path=c:\\tmp
+multi=a, \
+      b
+key\ with\ spaces=\u00e9
+empty
+`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"db.host":         "db.local",
+		"db.port":         "5432",
+		"name":            "app",
+		"path":            `c:\tmp`,
+		"multi":           "a, b",
+		"key with spaces": "é",
+		"empty":           "",
+	}, m)
+
+	_, err = parseProperties([]byte(`a=\u12`))
+	assert.EqualError(t, err, `invalid unicode escape in "\\u12"`)
+}
@@ -0,0 +1,188 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cuelang.org/go/cue"
+)
+
+// httpTimeout bounds the time spent fetching a remote value.
+const httpTimeout = 30 * time.Second
+
+// HTTP injector uses a remote document as source of the inject value.
+type HTTP struct {
+	path   cue.Path
+	result chan interface{}
+}
+
+// NewHTTP creates a new HTTP injector, getting u with the given headers.
+// format is the document format (json, yaml, toml, env, properties, cue or text).
+// If empty, it is guessed from the response Content-Type, then from the url extension.
+// Responses are shared through cache, if not nil, and fetched once pool has a worker available,
+// within httpTimeout or until ctx is done.
+func NewHTTP(ctx context.Context, u, srcPath, format string, header http.Header, dstPath cue.Path, cache *HTTPCache, pool *Pool) *HTTP {
+	r := make(chan interface{}, 1)
+	pool.run(dstPath, u, func() { parseHTTP(ctx, u, srcPath, format, header, cache, r) })
+	return &HTTP{path: dstPath, result: r}
+}
+
+// Inject returns the target value after injection.
+func (h *HTTP) Inject(target cue.Value) cue.Value {
+	return target.FillPath(h.path, h.value(target))
+}
+
+func (h *HTTP) value(cue.Value) interface{} {
+	return <-h.result
+}
+
+func parseHTTP(ctx context.Context, u, jpath, format string, header http.Header, cache *HTTPCache, res chan<- interface{}) {
+	defer close(res)
+
+	resp := cache.get(ctx, u, header)
+	if resp.err != nil {
+		res <- resp.err
+		return
+	}
+
+	ext := "." + format
+	switch {
+	case format == "text":
+		jpath = ""
+	case format != "":
+	case strings.Contains(resp.contentType, "json"):
+		ext = ".json"
+	case strings.Contains(resp.contentType, "yaml"):
+		ext = ".yaml"
+	default:
+		ext = urlExt(u)
+	}
+
+	v, err := extract(resp.body, ext, jpath)
+	if err != nil {
+		res <- err
+		return
+	}
+	res <- v
+}
+
+func urlExt(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return path.Ext(u.Path)
+}
+
+// HTTPCache holds the responses of HTTP injections.
+// It makes sure a given url is only fetched once, even by concurrent injectors.
+type HTTPCache struct {
+	mu        sync.Mutex
+	responses map[string]*httpResponse
+}
+
+type httpResponse struct {
+	once        sync.Once
+	body        []byte
+	contentType string
+	err         error
+}
+
+// NewHTTPCache returns an empty HTTPCache.
+func NewHTTPCache() *HTTPCache {
+	return &HTTPCache{responses: make(map[string]*httpResponse)}
+}
+
+// get returns the response of u, fetched until ctx is done. A nil cache always fetches u.
+func (c *HTTPCache) get(ctx context.Context, u string, header http.Header) *httpResponse {
+	if c == nil {
+		r := new(httpResponse)
+		r.fetch(ctx, u, header)
+		return r
+	}
+
+	key := cacheKey(u, header)
+	c.mu.Lock()
+	r, ok := c.responses[key]
+	if !ok {
+		r = new(httpResponse)
+		c.responses[key] = r
+	}
+	c.mu.Unlock()
+
+	r.once.Do(func() { r.fetch(ctx, u, header) })
+	return r
+}
+
+func cacheKey(u string, header http.Header) string {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b := &strings.Builder{}
+	b.WriteString(u)
+	for _, k := range keys {
+		fmt.Fprintf(b, "\n%s: %s", k, strings.Join(header[k], ", "))
+	}
+	return b.String()
+}
+
+func (r *httpResponse) fetch(ctx context.Context, u string, header http.Header) {
+	ctx, cancel := context.WithTimeout(ctx, httpTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		r.err = fmt.Errorf("failed to create request: %w", err)
+		return
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		r.err = fmt.Errorf("failed to get %s: %w", req.URL.Redacted(), err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		r.err = notFound("failed to get %s: unexpected status %s", req.URL.Redacted(), resp.Status)
+		return
+	}
+	if resp.StatusCode >= 400 {
+		r.err = fmt.Errorf("failed to get %s: unexpected status %s", req.URL.Redacted(), resp.Status)
+		return
+	}
+
+	r.body, r.err = io.ReadAll(resp.Body)
+	if r.err != nil {
+		r.err = fmt.Errorf("failed to read %s: %w", req.URL.Redacted(), r.err)
+	}
+	r.contentType = resp.Header.Get("Content-Type")
+}
@@ -0,0 +1,111 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func configServer(t *testing.T, hits *int32) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+		switch r.URL.Path {
+		case "/vpc":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"vpc": {"id": "vpc-42"}}`)
+		case "/endpoints.yaml":
+			fmt.Fprint(w, "endpoints:\n  db: db.internal:5432\n")
+		case "/private":
+			if r.Header.Get("Authorization") != "Bearer s3cr3t" || r.Header.Get("X-Team") != "platform" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, "granted")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHTTPInject(t *testing.T) {
+	var hits int32
+	srv := configServer(t, &hits)
+	cache := NewHTTPCache()
+
+	ctx := cuecontext.New()
+	v := ctx.CompileString("vpc: string, db: string, raw: string, again: string")
+	for _, h := range []*HTTP{
+		NewHTTP(context.Background(), srv.URL+"/vpc", "$.vpc.id", "", nil, cue.ParsePath("vpc"), cache, nil),
+		NewHTTP(context.Background(), srv.URL+"/endpoints.yaml", "$.endpoints.db", "", nil, cue.ParsePath("db"), cache, nil),
+		NewHTTP(context.Background(), srv.URL+"/vpc", "$.vpc.id", "text", nil, cue.ParsePath("raw"), cache, nil),
+		NewHTTP(context.Background(), srv.URL+"/vpc", "$.vpc.id", "", nil, cue.ParsePath("again"), cache, nil),
+	} {
+		v = h.Inject(v)
+	}
+	require.NoError(t, v.Err())
+	actual, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"vpc":"vpc-42","db":"db.internal:5432","raw":"{\"vpc\": {\"id\": \"vpc-42\"}}","again":"vpc-42"}`, string(actual))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+
+	// not found
+	v = NewHTTP(context.Background(), srv.URL+"/missing", "", "", nil, cue.ParsePath("foo"), nil, nil).Inject(ctx.CompileString("foo: string"))
+	assert.ErrorContains(t, v.Err(), "unexpected status 404 Not Found")
+
+	// canceled
+	cctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	v = NewHTTP(cctx, srv.URL+"/vpc", "", "", nil, cue.ParsePath("foo"), nil, nil).Inject(ctx.CompileString("foo: string"))
+	assert.ErrorContains(t, v.Err(), "context canceled")
+}
+
+func TestInjectHTTP(t *testing.T) {
+	var hits int32
+	srv := configServer(t, &hits)
+	t.Setenv("CONFIG_TOKEN", "s3cr3t")
+	t.Setenv("CONFIG_TEAM", "platform")
+
+	ctx := cuecontext.New()
+	v := ctx.CompileString(fmt.Sprintf(`
+vpc: string @inject(type=http, url="%[1]s/vpc", path=$.vpc.id)
+id: string @inject(type=http, url="%[1]s/vpc", path=$.vpc.id)
+private: string @inject(type=http, url="%[1]s/private", auth=CONFIG_TOKEN, header=X-Team:CONFIG_TEAM)
+`, srv.URL))
+
+	v = Inject(v, nil)
+	require.NoError(t, v.Err())
+	actual, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"vpc":"vpc-42","id":"vpc-42","private":"granted"}`, string(actual))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&hits))
+
+	v = Inject(ctx.CompileString("foo: _ @inject(type=http)"), nil)
+	assert.EqualError(t, v.Err(), "injection error: missing url key for http injector")
+	v = Inject(ctx.CompileString(fmt.Sprintf(`foo: _ @inject(type=http, url="%s/private", auth=CUEBE_UNSET)`, srv.URL)), nil)
+	assert.EqualError(t, v.Err(), "injection error: environment variable CUEBE_UNSET is not set")
+}
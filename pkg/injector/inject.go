@@ -1,33 +1,182 @@
 package injector
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
 
 	"cuelang.org/go/cue"
+	"github.com/loft-orbital/cuebe/internal/utils"
+	"github.com/loft-orbital/cuebe/pkg/log"
+	"github.com/loft-orbital/cuebe/pkg/sensitive"
+	"github.com/loft-orbital/cuebe/pkg/unifier"
 )
 
+// Options configures an injection.
+type Options struct {
+	// FS is the filesystem file injections read from.
+	FS fs.FS
+	// Cluster returns the cluster k8s injections read from.
+	// It is only called if needed, at most once.
+	Cluster ClusterFunc
+	// Registry provides the injectors of every injection type.
+	// Defaults to DefaultRegistry.
+	Registry *Registry
+	// Sensitive, if set, collects the paths of the sensitive injected values:
+	// values read from encrypted files or Secrets, or injected with sensitive=true.
+	Sensitive *sensitive.Paths
+	// Context bounds the requests and commands of http, k8s and exec injections.
+	// Defaults to context.Background().
+	Context context.Context
+	// AllowExec lists the executables exec injections may run.
+	// Exec injections are refused if empty.
+	AllowExec []string
+	// FileCache holds the files already read, and decrypted, by the caller.
+	// Defaults to an empty FileCache.
+	FileCache *FileCache
+	// Workers is the number of injections prepared concurrently.
+	// Defaults to DefaultWorkers.
+	Workers int
+	// Logger receives the duration of every injection, if it is a log.DebugLogger.
+	Logger log.Logger
+}
+
+// Session holds the resources shared by the injectors of an injection.
+type Session struct {
+	// FS is the filesystem file injections read from.
+	FS fs.FS
+	// Cluster returns the cluster k8s injections read from.
+	Cluster ClusterFunc
+	// HTTPCache makes sure remote values are fetched once per injection.
+	HTTPCache *HTTPCache
+	// FileCache makes sure files are read and decrypted once per injection.
+	FileCache *FileCache
+	// Pool bounds the number of injections prepared concurrently and logs their durations.
+	// Every injector running in the background should be started through it.
+	Pool *Pool
+	// Sensitive collects the paths of the sensitive injected values. It may be nil.
+	Sensitive *sensitive.Paths
+	// Context bounds the requests and commands of http, k8s and exec injections.
+	// It is never nil, defaulting to context.Background().
+	Context context.Context
+	// AllowExec lists the executables exec injections may run.
+	AllowExec []string
+}
+
 // Inject fill a cue value following the injection attributes.
 // c.f. https://github.com/loft-orbital/cuebe#inject
 func Inject(v cue.Value, fsys fs.FS) cue.Value {
-	injections := []Injector{}
+	return InjectWith(v, Options{FS: fsys})
+}
+
+// InjectWith fill a cue value following the injection attributes, with the given options.
+func InjectWith(v cue.Value, opts Options) cue.Value {
+	r := opts.Registry
+	if r == nil {
+		r = DefaultRegistry
+	}
+	s := &Session{
+		FS:        opts.FS,
+		Cluster:   opts.Cluster.once(),
+		HTTPCache: NewHTTPCache(),
+		FileCache: opts.FileCache,
+		Pool:      NewPool(opts.Workers, opts.Logger),
+		Sensitive: opts.Sensitive,
+		Context:   opts.Context,
+		AllowExec: opts.AllowExec,
+	}
+	if s.Context == nil {
+		s.Context = context.Background()
+	}
+	if s.FileCache == nil {
+		s.FileCache = NewFileCache()
+	}
+	pending := []*injection{}
 	v.Walk(func(v cue.Value) bool {
-		// Check for inject
+		// Check for inject, nested ones included
 		if a := v.Attribute("inject"); a.Err() == nil {
-			injections = append(injections, addInjector(&a, v.Path(), fsys))
-			return false // no nested injection
+			pending = append(pending, newInjection(a, v.Path()))
 		}
 		return true
 	}, nil)
-	// do inject
-	for _, i := range injections {
-		v = i.Inject(v)
+
+	// inject in dependency order, independent injections being prepared concurrently
+	for len(pending) > 0 {
+		var ready []Injector
+		var waiting []*injection
+		for _, i := range pending {
+			if i.ready(v, pending) {
+				ready = append(ready, i.injector(v, r, s))
+			} else {
+				waiting = append(waiting, i)
+			}
+		}
+		if len(ready) == 0 {
+			ready, waiting = unblock(v, waiting, r, s)
+		}
+		for _, i := range ready {
+			v = i.Inject(v)
+		}
+		pending = waiting
 	}
 	return v
 }
 
-func addInjector(attr *cue.Attribute, dst cue.Path, fsys fs.FS) Injector {
+// FileSources returns the sources of the file injections of v: file names, directories or glob patterns.
+// Sources referring to other values are left out, since they are only known once injected.
+func FileSources(v cue.Value) []string {
+	if !v.Exists() {
+		return nil
+	}
+	var srcs []string
+	v.Walk(func(v cue.Value) bool {
+		a := v.Attribute("inject")
+		if a.Err() != nil {
+			return true
+		}
+		if t, _, _ := a.Lookup(0, "type"); t != "file" {
+			return true
+		}
+		if src, found, _ := a.Lookup(0, "src"); found && !refPattern.MatchString(src) {
+			srcs = append(srcs, src)
+		}
+		return true
+	}, nil)
+	return srcs
+}
+
+// unblock is called when none of the pending injections are ready.
+// It fails the injections being part of a cycle or, if there are none,
+// the ones not depending on another pending injection, on their unresolvable references.
+func unblock(v cue.Value, pending []*injection, r *Registry, s *Session) (failed []Injector, waiting []*injection) {
+	for _, i := range pending {
+		if c := cycle(i, pending); c != nil {
+			failed = append(failed, NewError(fmt.Errorf("injection cycle: %s", strings.Join(c, " -> ")), i.dst))
+		} else {
+			waiting = append(waiting, i)
+		}
+	}
+	if len(failed) > 0 {
+		return failed, waiting
+	}
+	waiting = nil
+	for _, i := range pending {
+		if dependsOnAny(i, pending) {
+			waiting = append(waiting, i)
+		} else {
+			failed = append(failed, i.injector(v, r, s))
+		}
+	}
+	return failed, waiting
+}
+
+func addInjector(attr *cue.Attribute, dst cue.Path, r *Registry, s *Session) Injector {
 	t, found, err := attr.Lookup(0, "type")
 	if err != nil {
 		return NewError(err, dst)
@@ -35,15 +184,51 @@ func addInjector(attr *cue.Attribute, dst cue.Path, fsys fs.FS) Injector {
 	if !found {
 		return NewError(errors.New("missing injector type"), dst)
 	}
-	switch t {
-	case "file":
-		return addFileInjector(attr, dst, fsys)
-	default:
+	f, ok := r.Lookup(t)
+	if !ok {
 		return NewError(fmt.Errorf("unsupported injector type %s", t), dst)
 	}
+
+	sens, err := boolArg(attr, "sensitive")
+	if err != nil {
+		return NewError(err, dst)
+	}
+	if sens {
+		s.Sensitive.Add(dst)
+	}
+
+	optional, err := boolArg(attr, "optional")
+	if err != nil {
+		return NewError(err, dst)
+	}
+	d, hasDefault, err := attr.Lookup(0, "default")
+	if err != nil {
+		return NewError(err, dst)
+	}
+	if !optional && !hasDefault {
+		return f(attr, dst, s)
+	}
+	var def *string
+	if hasDefault {
+		def = &d
+	}
+	return NewOptional(f(attr, dst, s), def, dst)
+}
+
+// boolArg returns the boolean value of the key argument of attr, false if not set.
+func boolArg(attr *cue.Attribute, key string) (bool, error) {
+	v, found, err := attr.Lookup(0, key)
+	if err != nil || !found {
+		return false, err
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value %s, expecting true or false", key, v)
+	}
+	return b, nil
 }
 
-func addFileInjector(attr *cue.Attribute, dst cue.Path, fsys fs.FS) Injector {
+func addFileInjector(attr *cue.Attribute, dst cue.Path, s *Session) Injector {
 	src, found, err := attr.Lookup(0, "src")
 	if err != nil {
 		return NewError(err, dst)
@@ -52,10 +237,211 @@ func addFileInjector(attr *cue.Attribute, dst cue.Path, fsys fs.FS) Injector {
 		return NewError(errors.New("missing src key for file injector"), dst)
 	}
 
-	p, _, err := attr.Lookup(0, "path")
+	p, err := selector(attr)
+	if err != nil {
+		return NewError(err, dst)
+	}
+
+	var enc Encoding
+	e, found, err := attr.Lookup(0, "encoding")
+	if err != nil {
+		return NewError(err, dst)
+	}
+	if found {
+		if p != "" {
+			return NewError(errors.New("encoding and path are mutually exclusive for file injector"), dst)
+		}
+		if enc, err = ParseEncoding(e); err != nil {
+			return NewError(err, dst)
+		}
+	}
+
+	if IsGlob(src) || isDir(s.FS, src) {
+		sensitiveMatches(src, dst, s)
+		return NewGlob(src, p, enc, dst, s.FS, s.FileCache, s.Pool)
+	}
+	if unifier.IsEncrypted(src) {
+		// decrypted values are sensitive
+		s.Sensitive.Add(dst)
+	}
+	if enc != "" {
+		return NewEncodedFile(src, enc, dst, s.FS, s.FileCache, s.Pool)
+	}
+	return NewFile(src, p, dst, s.FS, s.FileCache, s.Pool)
+}
+
+// sensitiveMatches marks the values injected from the encrypted files matching pattern as sensitive.
+func sensitiveMatches(pattern string, dst cue.Path, s *Session) {
+	if s.FS == nil {
+		return
+	}
+	names, _ := matches(pattern, s.FS)
+	for _, n := range names {
+		if unifier.IsEncrypted(n) {
+			s.Sensitive.Add(cue.MakePath(append(dst.Selectors(), cue.Str(path.Base(n)))...))
+		}
+	}
+}
+
+func isDir(fsys fs.FS, name string) bool {
+	if fsys == nil {
+		return false
+	}
+	info, err := fs.Stat(fsys, name)
+	return err == nil && info.IsDir()
+}
+
+func addEnvInjector(attr *cue.Attribute, dst cue.Path, _ *Session) Injector {
+	name, found, err := attr.Lookup(0, "name")
+	if err != nil {
+		return NewError(err, dst)
+	}
+	if !found {
+		return NewError(errors.New("missing name key for env injector"), dst)
+	}
+
+	return NewEnv(name, dst)
+}
+
+func addHTTPInjector(attr *cue.Attribute, dst cue.Path, s *Session) Injector {
+	u, found, err := attr.Lookup(0, "url")
+	if err != nil {
+		return NewError(err, dst)
+	}
+	if !found {
+		return NewError(errors.New("missing url key for http injector"), dst)
+	}
+
+	p, err := selector(attr)
+	if err != nil {
+		return NewError(err, dst)
+	}
+	format, _, err := attr.Lookup(0, "format")
+	if err != nil {
+		return NewError(err, dst)
+	}
+
+	// credentials are always read from the environment
+	header := http.Header{}
+	for i := 0; i < attr.NumArgs(); i++ {
+		k, v := attr.Arg(i)
+		switch k {
+		case "auth":
+			token, ok := os.LookupEnv(v)
+			if !ok {
+				return NewError(fmt.Errorf("environment variable %s is not set", v), dst)
+			}
+			header.Set("Authorization", "Bearer "+token)
+		case "header":
+			name, env, ok := utils.Cut(v, ":")
+			if !ok {
+				return NewError(fmt.Errorf("invalid header %s, expecting <name>:<env var>", v), dst)
+			}
+			value, ok := os.LookupEnv(env)
+			if !ok {
+				return NewError(fmt.Errorf("environment variable %s is not set", env), dst)
+			}
+			header.Add(name, value)
+		}
+	}
+
+	return NewHTTP(s.Context, u, p, format, header, dst, s.HTTPCache, s.Pool)
+}
+
+func addK8sInjector(attr *cue.Attribute, dst cue.Path, s *Session) Injector {
+	keys := []string{"kind", "namespace", "name", "key"}
+	values := make([]string, len(keys))
+	for i, k := range keys {
+		v, found, err := attr.Lookup(0, k)
+		if err != nil {
+			return NewError(err, dst)
+		}
+		if !found {
+			return NewError(fmt.Errorf("missing %s key for k8s injector", k), dst)
+		}
+		values[i] = v
+	}
+
+	if values[0] == "Secret" {
+		s.Sensitive.Add(dst)
+	}
+	return NewK8s(s.Context, values[0], values[1], values[2], values[3], dst, s.Cluster, s.Pool)
+}
+
+func addExecInjector(attr *cue.Attribute, dst cue.Path, s *Session) Injector {
+	name, found, err := attr.Lookup(0, "cmd")
 	if err != nil {
 		return NewError(err, dst)
 	}
+	if !found {
+		return NewError(errors.New("missing cmd key for exec injector"), dst)
+	}
+	// the allowlist comes from the command line, so that sources can't run arbitrary commands
+	if !contains(s.AllowExec, name) {
+		return NewError(fmt.Errorf("executable %s is not allowed", name), dst)
+	}
+
+	p, err := selector(attr)
+	if err != nil {
+		return NewError(err, dst)
+	}
+	format, _, err := attr.Lookup(0, "format")
+	if err != nil {
+		return NewError(err, dst)
+	}
+
+	var args []string
+	for i := 0; i < attr.NumArgs(); i++ {
+		switch k, v := attr.Arg(i); k {
+		case "args":
+			args = append(args, strings.Fields(v)...)
+		case "arg":
+			args = append(args, v)
+		}
+	}
+
+	// commands are mostly used to get secrets
+	if _, found, _ := attr.Lookup(0, "sensitive"); !found {
+		s.Sensitive.Add(dst)
+	}
+	return NewExec(s.Context, name, args, p, format, dst, s.Pool)
+}
+
+// selector returns the selector of the injected value: either the path JSONPath expression,
+// or the cuepath CUE path. It is empty if the value is not structured.
+func selector(attr *cue.Attribute) (string, error) {
+	p, foundPath, err := attr.Lookup(0, "path")
+	if err != nil {
+		return "", err
+	}
+	cp, foundCUEPath, err := attr.Lookup(0, "cuepath")
+	if err != nil {
+		return "", err
+	}
 
-	return NewFile(src, p, dst, fsys)
+	switch {
+	case foundPath && foundCUEPath:
+		return "", errors.New("path and cuepath are mutually exclusive")
+	case foundCUEPath:
+		if isJSONPath(cp) {
+			return "", fmt.Errorf("cuepath %s can't start with the $ identifier", cp)
+		}
+		if err := cue.ParsePath(cp).Err(); err != nil {
+			return "", fmt.Errorf("invalid cuepath %s: %w", cp, err)
+		}
+		return cp, nil
+	case p != "" && !isJSONPath(p):
+		return "", fmt.Errorf("path %s is not a JSONPath expression, use cuepath for CUE paths", p)
+	default:
+		return p, nil
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
 }
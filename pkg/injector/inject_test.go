@@ -7,8 +7,12 @@ import (
 	"path"
 	"runtime"
 	"testing"
+	"testing/fstest"
 
+	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/cuecontext"
+	"github.com/loft-orbital/cuebe/internal/utils"
+	"github.com/loft-orbital/cuebe/pkg/sensitive"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -58,3 +62,296 @@ func TestInjectFile(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "{\"foo\":42}", string(json))
 }
+
+func TestInjectEnv(t *testing.T) {
+	t.Setenv("CUEBE_REPLICAS", "3")
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`
+replicas: int @inject(type=env, name=CUEBE_REPLICAS)
+tag: string @inject(type=env, name=CUEBE_UNSET, default=latest)
+`)
+
+	v = Inject(v, nil)
+	assert.NoError(t, v.Err())
+	json, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"replicas":3,"tag":"latest"}`, string(json))
+
+	v = Inject(ctx.CompileString("foo: _ @inject(type=env)"), nil)
+	assert.EqualError(t, v.Err(), "injection error: missing name key for env injector")
+}
+
+func TestInjectK8s(t *testing.T) {
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`password: string @inject(type=k8s, kind=Secret, namespace=prod, name=db, key=password)`)
+
+	calls := 0
+	cluster := fakeCluster()
+	v = InjectWith(v, Options{Cluster: func() (*utils.K8sConfig, error) {
+		calls++
+		return cluster()
+	}})
+	assert.NoError(t, v.Err())
+	json, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"password":"s3cr3t"}`, string(json))
+	assert.Equal(t, 1, calls)
+
+	v = Inject(ctx.CompileString("foo: _ @inject(type=k8s, kind=Secret, namespace=prod, name=db)"), nil)
+	assert.EqualError(t, v.Err(), "injection error: missing key key for k8s injector")
+	v = Inject(ctx.CompileString("foo: _ @inject(type=k8s, kind=Secret, namespace=prod, name=db, key=password)"), nil)
+	assert.EqualError(t, v.Err(), "failed to get cluster: no cluster configured")
+}
+
+func TestInjectFileEncoding(t *testing.T) {
+	fsys := fstest.MapFS{"tls.key": {Data: []byte("key")}}
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`data: "tls.key": string @inject(type=file, src=tls.key, encoding=base64)`)
+
+	v = Inject(v, fsys)
+	assert.NoError(t, v.Err())
+	json, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"data":{"tls.key":"a2V5"}}`, string(json))
+
+	v = Inject(ctx.CompileString("foo: _ @inject(type=file, src=tls.key, encoding=rot13)"), fsys)
+	assert.EqualError(t, v.Err(), "injection error: unsupported encoding rot13, expecting base64, hex or raw")
+	v = Inject(ctx.CompileString("foo: _ @inject(type=file, src=tls.key, path=$.a, encoding=hex)"), fsys)
+	assert.EqualError(t, v.Err(), "injection error: encoding and path are mutually exclusive for file injector")
+}
+
+func TestInjectGlob(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dashboards/cpu.json":    {Data: []byte(`{"title": "CPU"}`)},
+		"dashboards/memory.json": {Data: []byte(`{"title": "Memory"}`)},
+	}
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`
+data: {[string]: string} @inject(type=file, src="dashboards/*.json", path=$.title)
+all: {[string]: string} @inject(type=file, src=dashboards)
+`)
+
+	v = Inject(v, fsys)
+	assert.NoError(t, v.Err())
+	json, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"data": {"cpu.json": "CPU", "memory.json": "Memory"},
+		"all": {"cpu.json": "{\"title\": \"CPU\"}", "memory.json": "{\"title\": \"Memory\"}"}
+	}`, string(json))
+}
+
+func TestInjectCUEPath(t *testing.T) {
+	fsys := fstest.MapFS{
+		"config.toml": {Data: []byte("[server]\nport = 8080\ntls = true\n[labels]\n\"app-name\" = \"api\"\n")},
+		"app.env":     {Data: []byte("LOG_LEVEL=debug\n")},
+		"values.cue":  {Data: []byte("replicas: 2\nimage: tag: \"v1\"\n")},
+	}
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`
+#Server: {port: int, tls: bool}
+server: #Server @inject(type=file, src=config.toml, cuepath=server)
+app: string @inject(type=file, src=config.toml, cuepath=labels."app-name")
+level: string @inject(type=file, src=app.env, cuepath=LOG_LEVEL)
+replicas: int @inject(type=file, src=values.cue, path=$.replicas)
+tag: string @inject(type=file, src=values.cue, cuepath=image.tag)
+`)
+
+	v = Inject(v, fsys)
+	assert.NoError(t, v.Err())
+	json, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"server": {"port": 8080, "tls": true},
+		"app": "api",
+		"level": "debug",
+		"replicas": 2,
+		"tag": "v1"
+	}`, string(json))
+
+	v = Inject(ctx.CompileString("foo: _ @inject(type=file, src=values.cue, cuepath=image.digest)"), fsys)
+	assert.EqualError(t, v.Err(), "failed to extract path: image.digest not found")
+	v = Inject(ctx.CompileString("foo: _ @inject(type=file, src=values.cue, path=$.replicas, cuepath=replicas)"), fsys)
+	assert.EqualError(t, v.Err(), "injection error: path and cuepath are mutually exclusive")
+	v = Inject(ctx.CompileString("foo: _ @inject(type=file, src=values.cue, cuepath=$.replicas)"), fsys)
+	assert.EqualError(t, v.Err(), "injection error: cuepath $.replicas can't start with the $ identifier")
+	v = Inject(ctx.CompileString("foo: _ @inject(type=file, src=values.cue, path=image.tag)"), fsys)
+	assert.EqualError(t, v.Err(), "injection error: path image.tag is not a JSONPath expression, use cuepath for CUE paths")
+	v = Inject(ctx.CompileString(`foo: _ @inject(type=file, src=values.cue, cuepath="a.[")`), fsys)
+	assert.ErrorContains(t, v.Err(), "injection error: invalid cuepath a.[")
+}
+
+func TestInjectOptional(t *testing.T) {
+	fsys := fstest.MapFS{"values.json": {Data: []byte(`{"replicas": 3}`)}}
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`
+replicas: int @inject(type=file, src=values.json, path=$.replicas, optional=true)
+password: string | *"dev" @inject(type=file, src=prod.enc.yaml, path=$.password, optional=true)
+image: tag: string @inject(type=file, src=values.json, cuepath=image.tag, default=latest)
+debug: bool @inject(type=env, name=CUEBE_TEST_UNSET, optional=true, default=true)
+dashboards: {[string]: string} @inject(type=file, src="dashboards/*.json", optional=true)
+`)
+
+	v = Inject(v, fsys)
+	assert.NoError(t, v.Err())
+	json, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"replicas": 3,
+		"password": "dev",
+		"image": {"tag": "latest"},
+		"debug": true,
+		"dashboards": {}
+	}`, string(json))
+
+	v = Inject(ctx.CompileString("foo: _ @inject(type=file, src=values.json, optional=maybe)"), fsys)
+	assert.EqualError(t, v.Err(), "injection error: invalid optional value maybe, expecting true or false")
+	v = Inject(ctx.CompileString("foo: _ @inject(type=file, src=prod.enc.yaml, optional=false)"), fsys)
+	assert.ErrorContains(t, v.Err(), "failed to read prod.enc.yaml")
+}
+
+func TestInjectDependent(t *testing.T) {
+	t.Setenv("CUEBE_TEST_ENV", "prod")
+	fsys := fstest.MapFS{
+		"envs/prod.yaml":  {Data: []byte("replicas: 3\nregion: eu")},
+		"envs/dev.yaml":   {Data: []byte("replicas: 1\nregion: us")},
+		"regions/eu.json": {Data: []byte(`{"zone": "eu-west-1"}`)},
+	}
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`
+zone: string @inject(type=file, src="regions/${config.region}.json", path=$.zone)
+config: {
+	replicas: int
+	region:   string
+} @inject(type=file, src="envs/${env}.yaml", path=$)
+file: "envs/\(env).yaml"
+raw: string @inject(type=file, src="${file}")
+env: string @inject(type=env, name=CUEBE_TEST_ENV)
+`)
+
+	v = Inject(v, fsys)
+	require.NoError(t, v.Err())
+	json, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"zone": "eu-west-1",
+		"config": {"replicas": 3, "region": "eu"},
+		"file": "envs/prod.yaml",
+		"raw": "replicas: 3\nregion: eu",
+		"env": "prod"
+	}`, string(json))
+}
+
+func TestInjectNested(t *testing.T) {
+	t.Setenv("CUEBE_TEST_REPLICAS", "3")
+	fsys := fstest.MapFS{
+		"config.yaml": {Data: []byte("name: potato\nlabels:\n  app: potato")},
+	}
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`
+config: {
+	replicas: int @inject(type=env, name=CUEBE_TEST_REPLICAS)
+	...
+} @inject(type=file, src=config.yaml, path=$)
+`)
+
+	v = Inject(v, fsys)
+	require.NoError(t, v.Err())
+	json, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"config": {"name": "potato", "labels": {"app": "potato"}, "replicas": 3}}`, string(json))
+}
+
+func TestInjectCycle(t *testing.T) {
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`
+a: string @inject(type=env, name="${b}")
+b: string @inject(type=env, name="${c.d}")
+c: d: string @inject(type=env, name="${a}")
+e: string @inject(type=env, name="${a}")
+`)
+
+	v = Inject(v, nil)
+	assert.ErrorContains(t, v.Err(), "injection error: injection cycle: a -> b -> c.d -> a")
+	assert.ErrorContains(t, v.LookupPath(cue.ParsePath("e")).Err(), "could not resolve ${a}")
+
+	v = ctx.CompileString(`a: string @inject(type=env, name="${a}")`)
+	v = Inject(v, nil)
+	assert.EqualError(t, v.Err(), "injection error: injection cycle: a -> a")
+}
+
+func TestInjectUnresolved(t *testing.T) {
+	ctx := cuecontext.New()
+	for ref, msg := range map[string]string{
+		"missing": "could not resolve ${missing}: field not found",
+		"tag":     "could not resolve ${tag}: incomplete value",
+		"list":    "could not resolve ${list}: list is not a string, a number or a bool",
+		"a.":      "invalid reference ${a.}",
+	} {
+		v := ctx.CompileString(fmt.Sprintf(`
+tag: string
+list: [1]
+foo: string @inject(type=env, name="${%s}")
+`, ref))
+		v = Inject(v, nil)
+		assert.ErrorContains(t, v.Err(), msg)
+	}
+}
+
+func TestInjectSensitive(t *testing.T) {
+	t.Setenv("CUEBE_TEST_TOKEN", "s3cr3t")
+	fsys := fstest.MapFS{
+		"secrets/db.enc.yaml": {Data: []byte("password: hunter2")},
+		"secrets/app.yaml":    {Data: []byte("name: app")},
+	}
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`
+token: string @inject(type=env, name=CUEBE_TEST_TOKEN, sensitive=true)
+plain: string @inject(type=env, name=CUEBE_TEST_TOKEN, sensitive=false)
+file: _ @inject(type=file, src=secrets/db.enc.yaml)
+dir: _ @inject(type=file, src=secrets)
+secret: _ @inject(type=k8s, kind=Secret, namespace=db, name=creds, key=password)
+configmap: _ @inject(type=k8s, kind=ConfigMap, namespace=db, name=creds, key=password)
+`)
+
+	sens := sensitive.NewPaths()
+	InjectWith(v, Options{FS: fsys, Sensitive: sens})
+	assert.Equal(t, []cue.Path{
+		cue.ParsePath(`dir."db.enc.yaml"`),
+		cue.ParsePath("file"),
+		cue.ParsePath("secret"),
+		cue.ParsePath("token"),
+	}, sens.List())
+
+	v = ctx.CompileString(`foo: _ @inject(type=env, name=CUEBE_TEST_TOKEN, sensitive=maybe)`)
+	v = Inject(v, nil)
+	assert.EqualError(t, v.Err(), "injection error: invalid sensitive value maybe, expecting true or false")
+}
+
+func TestInjectFileCache(t *testing.T) {
+	cache := NewFileCache()
+	b, err := cache.ReadFile("db.json", fstest.MapFS{"db.json": {Data: []byte(`{"password": "hunter2"}`)}})
+	require.NoError(t, err)
+	assert.Equal(t, `{"password": "hunter2"}`, string(b))
+
+	// files already read are not read again
+	ctx := cuecontext.New()
+	v := ctx.CompileString("password: string @inject(type=file, src=db.json, path=$.password)")
+	v = InjectWith(v, Options{FS: fstest.MapFS{"db.json": {Data: []byte(`{"password": "changed"}`)}}, FileCache: cache})
+	require.NoError(t, v.Err())
+	password, _ := v.LookupPath(cue.ParsePath("password")).String()
+	assert.Equal(t, "hunter2", password)
+}
+
+func TestFileSources(t *testing.T) {
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`
+env: "prod"
+a: _ @inject(type=file, src=db.enc.yaml, path=$.password)
+b: c: _ @inject(type=file, src="dashboards/*.json")
+d: _ @inject(type=file, src="envs/${env}.yaml")
+e: _ @inject(type=env, name=HOME)
+`)
+	assert.Equal(t, []string{"db.enc.yaml", "dashboards/*.json"}, FileSources(v))
+	assert.Empty(t, FileSources(cue.Value{}))
+}
@@ -0,0 +1,148 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+
+	"cuelang.org/go/cue"
+	"github.com/loft-orbital/cuebe/internal/utils"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ClusterFunc returns the cluster Kubernetes injections read from.
+type ClusterFunc func() (*utils.K8sConfig, error)
+
+// once returns a ClusterFunc calling f only once.
+func (f ClusterFunc) once() ClusterFunc {
+	if f == nil {
+		return func() (*utils.K8sConfig, error) {
+			return nil, errors.New("no cluster configured")
+		}
+	}
+	var o sync.Once
+	var c *utils.K8sConfig
+	var err error
+	return func() (*utils.K8sConfig, error) {
+		o.Do(func() { c, err = f() })
+		return c, err
+	}
+}
+
+// k8sResources maps the supported kinds to their resource.
+var k8sResources = map[string]schema.GroupVersionResource{
+	"Secret":    {Version: "v1", Resource: "secrets"},
+	"ConfigMap": {Version: "v1", Resource: "configmaps"},
+}
+
+// K8s injector uses a key of a live Secret or ConfigMap as source of the inject value.
+type K8s struct {
+	path   cue.Path
+	result chan interface{}
+}
+
+// NewK8s creates a new Kubernetes injector, reading key of the kind (Secret or ConfigMap)
+// namespace/name object, once pool has a worker available, within httpTimeout or until ctx is done.
+// Secret values are base64 decoded.
+func NewK8s(ctx context.Context, kind, namespace, name, key string, dstPath cue.Path, cluster ClusterFunc, pool *Pool) *K8s {
+	r := make(chan interface{}, 1)
+	src := fmt.Sprintf("%s %s/%s", kind, namespace, name)
+	pool.run(dstPath, src, func() { getK8s(ctx, kind, namespace, name, key, cluster, r) })
+	return &K8s{path: dstPath, result: r}
+}
+
+// Inject returns the target value after injection.
+func (k *K8s) Inject(target cue.Value) cue.Value {
+	return target.FillPath(k.path, k.value(target))
+}
+
+func (k *K8s) value(cue.Value) interface{} {
+	return <-k.result
+}
+
+func getK8s(ctx context.Context, kind, namespace, name, key string, cluster ClusterFunc, res chan<- interface{}) {
+	defer close(res)
+
+	gvr, ok := k8sResources[kind]
+	if !ok {
+		res <- fmt.Errorf("unsupported kind %s, expecting Secret or ConfigMap", kind)
+		return
+	}
+	konfig, err := cluster()
+	if err != nil {
+		res <- fmt.Errorf("failed to get cluster: %w", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, httpTimeout)
+	defer cancel()
+	u, err := konfig.DynamicClient.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		res <- notFound("failed to get %s %s/%s: %v", kind, namespace, name, err)
+		return
+	}
+	if err != nil {
+		res <- fmt.Errorf("failed to get %s %s/%s: %w", kind, namespace, name, err)
+		return
+	}
+
+	v, err := k8sValue(kind, u, key)
+	if err != nil {
+		res <- fmt.Errorf("%s %s/%s: %w", kind, namespace, name, err)
+		return
+	}
+	res <- v
+}
+
+var errKeyNotFound = notFound("key not found")
+
+// k8sValue returns the decoded value of key in a Secret or ConfigMap.
+func k8sValue(kind string, u *unstructured.Unstructured, key string) (string, error) {
+	if kind == "Secret" {
+		return lookupKey(u, "data", key, true)
+	}
+	// ConfigMap binary values are encoded
+	s, err := lookupKey(u, "data", key, false)
+	if errors.Is(err, errKeyNotFound) {
+		return lookupKey(u, "binaryData", key, true)
+	}
+	return s, err
+}
+
+func lookupKey(u *unstructured.Unstructured, field, key string, encoded bool) (string, error) {
+	s, found, err := unstructured.NestedString(u.Object, field, key)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s.%s: %w", field, key, err)
+	}
+	if !found {
+		return "", fmt.Errorf("%s: %w", key, errKeyNotFound)
+	}
+	if !encoded {
+		return s, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", fmt.Errorf("could not decode %s.%s: %w", field, key, err)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,81 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/loft-orbital/cuebe/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dfake "k8s.io/client-go/dynamic/fake"
+)
+
+func fakeCluster() ClusterFunc {
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "db", "namespace": "prod"},
+		"data":       map[string]interface{}{"password": "czNjcjN0"},
+	}}
+	cm := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "endpoints", "namespace": "prod"},
+		"data":       map[string]interface{}{"db": "db.internal:5432"},
+		"binaryData": map[string]interface{}{"cert": "Y2VydA=="},
+	}}
+	client := dfake.NewSimpleDynamicClient(runtime.NewScheme(), secret, cm)
+	return func() (*utils.K8sConfig, error) {
+		return &utils.K8sConfig{DynamicClient: client}, nil
+	}
+}
+
+func TestK8sInject(t *testing.T) {
+	cluster := fakeCluster()
+	ctx := cuecontext.New()
+
+	v := ctx.CompileString("password: string, db: string, cert: string")
+	for _, k := range []*K8s{
+		NewK8s(context.Background(), "Secret", "prod", "db", "password", cue.ParsePath("password"), cluster, nil),
+		NewK8s(context.Background(), "ConfigMap", "prod", "endpoints", "db", cue.ParsePath("db"), cluster, nil),
+		NewK8s(context.Background(), "ConfigMap", "prod", "endpoints", "cert", cue.ParsePath("cert"), cluster, nil),
+	} {
+		v = k.Inject(v)
+	}
+	require.NoError(t, v.Err())
+	actual, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"password":"s3cr3t","db":"db.internal:5432","cert":"cert"}`, string(actual))
+
+	foo := ctx.CompileString("foo: string")
+	v = NewK8s(context.Background(), "Secret", "prod", "db", "user", cue.ParsePath("foo"), cluster, nil).Inject(foo)
+	assert.EqualError(t, v.Err(), "Secret prod/db: user: key not found")
+	v = NewK8s(context.Background(), "Secret", "prod", "missing", "user", cue.ParsePath("foo"), cluster, nil).Inject(foo)
+	assert.ErrorContains(t, v.Err(), "failed to get Secret prod/missing")
+	v = NewK8s(context.Background(), "Pod", "prod", "db", "user", cue.ParsePath("foo"), cluster, nil).Inject(foo)
+	assert.EqualError(t, v.Err(), "unsupported kind Pod, expecting Secret or ConfigMap")
+	v = NewK8s(context.Background(), "Secret", "prod", "db", "user", cue.ParsePath("foo"), func() (*utils.K8sConfig, error) {
+		return nil, errors.New("no kube config")
+	}, nil).Inject(foo)
+	assert.EqualError(t, v.Err(), "failed to get cluster: no kube config")
+}
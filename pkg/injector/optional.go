@@ -0,0 +1,73 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"cuelang.org/go/cue"
+)
+
+// source is implemented by the injectors reading a source.
+// value returns what they inject in target: a value, or the error preventing the injection.
+type source interface {
+	Injector
+	value(target cue.Value) interface{}
+}
+
+// Optional injector wraps an injector, leaving the target value untouched
+// or injecting a default value when its source is absent.
+type Optional struct {
+	injector Injector
+	path     cue.Path
+	def      *string
+}
+
+// NewOptional creates a new optional injector, wrapping i.
+// def is injected when the source of i is absent, if not nil.
+// It is converted to the kind of the target value, like environment variables.
+func NewOptional(i Injector, def *string, dstPath cue.Path) *Optional {
+	return &Optional{injector: i, path: dstPath, def: def}
+}
+
+// Inject returns the target value after injection.
+func (o *Optional) Inject(target cue.Value) cue.Value {
+	s, ok := o.injector.(source)
+	if !ok {
+		return o.injector.Inject(target)
+	}
+
+	r := s.value(target)
+	if err, ok := r.(error); !ok || !IsNotFound(err) {
+		return target.FillPath(o.path, r)
+	}
+	if o.def == nil {
+		return target
+	}
+	v, err := coerce(*o.def, target.LookupPath(o.path).IncompleteKind())
+	if err != nil {
+		return NewError(fmt.Errorf("could not convert default: %w", err), o.path).Inject(target)
+	}
+	return target.FillPath(o.path, v)
+}
+
+// IsNotFound reports whether err comes from an absent injection source:
+// a missing file, or any error matching ErrNotFound.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, fs.ErrNotExist)
+}
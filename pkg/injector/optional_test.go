@@ -0,0 +1,79 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptionalInject(t *testing.T) {
+	fsys := fstest.MapFS{"config.json": {Data: []byte(`{"replicas": 3, "items": []}`)}}
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`
+found: int
+missing: int | *1
+path: int | *1
+def: int
+`)
+	one := "1"
+	two := "2"
+	for _, i := range []Injector{
+		NewOptional(NewFile("config.json", "$.replicas", cue.ParsePath("found"), fsys, nil, nil), &one, cue.ParsePath("found")),
+		NewOptional(NewFile("prod.enc.json", "$.replicas", cue.ParsePath("missing"), fsys, nil, nil), nil, cue.ParsePath("missing")),
+		NewOptional(NewFile("config.json", "limits.max", cue.ParsePath("path"), fsys, nil, nil), nil, cue.ParsePath("path")),
+		NewOptional(NewGlob("*.yaml", "", "", cue.ParsePath("def"), fsys, nil, nil), &two, cue.ParsePath("def")),
+	} {
+		v = i.Inject(v)
+	}
+	assert.NoError(t, v.Err())
+	json, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"found": 3, "missing": 1, "path": 1, "def": 2}`, string(json))
+
+	// other errors are still reported
+	v = ctx.CompileString("foo: int")
+	v = NewOptional(NewFile("config.json", "$[", cue.ParsePath("foo"), fsys, nil, nil), nil, cue.ParsePath("foo")).Inject(v)
+	assert.ErrorContains(t, v.Err(), "invalid path $[")
+	// selecting in a value of another type is not an absent source
+	for _, sel := range []string{"$.replicas.max", "replicas.max", "$.replicas[0]"} {
+		v = ctx.CompileString("foo: int")
+		v = NewOptional(NewFile("config.json", sel, cue.ParsePath("foo"), fsys, nil, nil), &one, cue.ParsePath("foo")).Inject(v)
+		assert.ErrorContains(t, v.Err(), "failed to extract path", sel)
+	}
+	v = ctx.CompileString("foo: int")
+	v = NewOptional(NewFile("config.json", "$.items[0]", cue.ParsePath("foo"), fsys, nil, nil), &one, cue.ParsePath("foo")).Inject(v)
+	assert.NoError(t, v.Err())
+	v = ctx.CompileString("foo: int")
+	notInt := "two"
+	v = NewOptional(NewGlob("*.yaml", "", "", cue.ParsePath("foo"), fsys, nil, nil), &notInt, cue.ParsePath("foo")).Inject(v)
+	assert.EqualError(t, v.Err(), `injection error: could not convert default: "two" is not an int`)
+}
+
+func TestIsNotFound(t *testing.T) {
+	assert.True(t, IsNotFound(notFound("no file matches %s", "*.yaml")))
+	assert.True(t, IsNotFound(NewError(notFound("environment variable FOO is not set"), cue.ParsePath("foo"))))
+	assert.True(t, IsNotFound(fmt.Errorf("failed to read a.json: %w", fs.ErrNotExist)))
+	assert.False(t, IsNotFound(errors.New("could not decrypt data")))
+	assert.EqualError(t, notFound("failed to extract path: %s not found", "a.b"), "failed to extract path: a.b not found")
+}
@@ -0,0 +1,66 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"time"
+
+	"cuelang.org/go/cue"
+	"github.com/loft-orbital/cuebe/pkg/log"
+)
+
+// DefaultWorkers is the default number of injections a Pool prepares concurrently.
+const DefaultWorkers = 8
+
+// Pool bounds the number of injections prepared concurrently,
+// whatever their type, and logs their durations.
+type Pool struct {
+	workers chan struct{}
+	logger  log.Logger
+}
+
+// NewPool returns a Pool preparing at most workers injections concurrently,
+// DefaultWorkers if workers is not positive. The duration of every injection is sent to logger,
+// if it is a log.DebugLogger.
+func NewPool(workers int, logger log.Logger) *Pool {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if logger == nil {
+		logger = log.DiscardLogger
+	}
+	return &Pool{
+		workers: make(chan struct{}, workers),
+		logger:  logger,
+	}
+}
+
+// run runs f, the preparation of the src injection at dst, in a new goroutine once a worker is available.
+// A nil pool runs f right away.
+func (p *Pool) run(dst cue.Path, src string, f func()) {
+	if p == nil {
+		go f()
+		return
+	}
+	go func() {
+		p.workers <- struct{}{}
+		defer func() { <-p.workers }()
+
+		start := time.Now()
+		f()
+		log.Debug(p.logger, "injected %s from %s in %s\n", dst, src, time.Since(start).Round(time.Millisecond))
+	}()
+}
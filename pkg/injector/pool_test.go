@@ -0,0 +1,96 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type debugLogger struct {
+	mu     sync.Mutex
+	debugs []string
+}
+
+func (l *debugLogger) Info(format string, v ...interface{})  {}
+func (l *debugLogger) Error(format string, v ...interface{}) {}
+func (l *debugLogger) Debug(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.debugs = append(l.debugs, fmt.Sprintf(format, v...))
+}
+
+func TestPool(t *testing.T) {
+	var mu sync.Mutex
+	var open, peak int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if open++; open > peak {
+			peak = open
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		open--
+		mu.Unlock()
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	logger := &debugLogger{}
+	pool := NewPool(2, logger)
+	fsys := fstest.MapFS{"a.txt": {Data: []byte("a")}}
+
+	injectors := []Injector{
+		NewFile("a.txt", "", cue.ParsePath("file"), fsys, nil, pool),
+		NewExec(context.Background(), "echo", []string{"b"}, "", "", cue.ParsePath("exec"), pool),
+	}
+	for i := 0; i < 6; i++ {
+		injectors = append(injectors, NewHTTP(context.Background(), fmt.Sprintf("%s/%d", srv.URL, i), "", "text", nil, cue.ParsePath(fmt.Sprintf("http%d", i)), nil, pool))
+	}
+	v := cuecontext.New().CompileString("{}")
+	for _, i := range injectors {
+		v = i.Inject(v)
+	}
+	require.NoError(t, v.Err())
+	s, _ := v.LookupPath(cue.ParsePath("http5")).String()
+	assert.Equal(t, "/5", s)
+
+	// every injection runs on one of the 2 workers
+	assert.LessOrEqual(t, peak, 2)
+	// and is timed, once done
+	assert.Eventually(t, func() bool {
+		logger.mu.Lock()
+		defer logger.mu.Unlock()
+		return len(logger.debugs) == len(injectors)
+	}, time.Second, 10*time.Millisecond)
+	sort.Strings(logger.debugs)
+	assert.Regexp(t, `^injected exec from echo in [0-9.]+m?s\n$`, logger.debugs[0])
+	assert.Regexp(t, `^injected file from a.txt in [0-9.]+m?s\n$`, logger.debugs[1])
+	assert.Regexp(t, `^injected http0 from http://.+/0 in [0-9.]+m?s\n$`, logger.debugs[2])
+}
@@ -0,0 +1,69 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"sync"
+
+	"cuelang.org/go/cue"
+)
+
+// Factory creates the Injector of an @inject attribute, filling the dst path.
+// Invalid attributes should be reported with an Error injector.
+type Factory func(attr *cue.Attribute, dst cue.Path, s *Session) Injector
+
+// Registry maps injection types to their Factory.
+// It is safe for concurrent use.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]Factory
+}
+
+// NewRegistry returns a Registry holding the built-in injection types:
+// file, env, http, k8s and exec.
+func NewRegistry() *Registry {
+	r := &Registry{factories: make(map[string]Factory)}
+	r.Register("file", addFileInjector)
+	r.Register("env", addEnvInjector)
+	r.Register("http", addHTTPInjector)
+	r.Register("k8s", addK8sInjector)
+	r.Register("exec", addExecInjector)
+	return r
+}
+
+// Register makes f available for the injection type name,
+// replacing any previously registered Factory.
+func (r *Registry) Register(name string, f Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = f
+}
+
+// Lookup returns the Factory registered for the injection type name.
+func (r *Registry) Lookup(name string) (Factory, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	f, ok := r.factories[name]
+	return f, ok
+}
+
+// DefaultRegistry is the Registry used when none is provided.
+var DefaultRegistry = NewRegistry()
+
+// Register makes f available for the injection type name in the DefaultRegistry.
+func Register(name string, f Factory) {
+	DefaultRegistry.Register(name, f)
+}
@@ -0,0 +1,82 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package injector
+
+import (
+	"errors"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/stretchr/testify/assert"
+)
+
+// constant injects a fixed value.
+type constant struct {
+	path  cue.Path
+	value interface{}
+}
+
+func (c constant) Inject(target cue.Value) cue.Value {
+	return target.FillPath(c.path, c.value)
+}
+
+func vault(attr *cue.Attribute, dst cue.Path, s *Session) Injector {
+	key, found, err := attr.Lookup(0, "key")
+	if err != nil || !found {
+		return NewError(errors.New("missing key"), dst)
+	}
+	return constant{path: dst, value: "vault:" + key}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	for _, name := range []string{"file", "env", "http", "k8s", "exec"} {
+		_, ok := r.Lookup(name)
+		assert.True(t, ok, name)
+	}
+	_, ok := r.Lookup("vault")
+	assert.False(t, ok)
+
+	r.Register("vault", vault)
+	ctx := cuecontext.New()
+	v := ctx.CompileString("password: string @inject(type=vault, key=db)")
+
+	actual := InjectWith(v, Options{Registry: r})
+	assert.NoError(t, actual.Err())
+	json, err := actual.MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"password":"vault:db"}`, string(json))
+
+	// not in the default registry
+	assert.EqualError(t, Inject(v, nil).Err(), "injection error: unsupported injector type vault")
+}
+
+func TestRegister(t *testing.T) {
+	Register("vault", vault)
+	defer func() {
+		DefaultRegistry.mu.Lock()
+		delete(DefaultRegistry.factories, "vault")
+		DefaultRegistry.mu.Unlock()
+	}()
+
+	ctx := cuecontext.New()
+	v := Inject(ctx.CompileString("password: string @inject(type=vault, key=db)"), nil)
+	assert.NoError(t, v.Err())
+	json, err := v.MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"password":"vault:db"}`, string(json))
+}
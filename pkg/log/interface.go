@@ -6,3 +6,16 @@ type Logger interface {
 	Info(format string, v ...any)
 	Error(format string, v ...any)
 }
+
+// DebugLogger is a Logger also receiving debug messages.
+type DebugLogger interface {
+	Logger
+	Debug(format string, v ...any)
+}
+
+// Debug sends a debug message to l, if it is a DebugLogger.
+func Debug(l Logger, format string, v ...any) {
+	if d, ok := l.(DebugLogger); ok {
+		d.Debug(format, v...)
+	}
+}
@@ -8,6 +8,7 @@ import (
 type IOLogger struct {
 	normW io.Writer
 	errW  io.Writer
+	debug bool
 }
 
 func NewIOLogger(out io.Writer, err io.Writer) *IOLogger {
@@ -24,3 +25,15 @@ func (l *IOLogger) Info(format string, a ...any) {
 func (l *IOLogger) Error(format string, a ...any) {
 	fmt.Fprintf(l.errW, format, a...)
 }
+
+// Debug writes to the error writer, only if debug messages are enabled.
+func (l *IOLogger) Debug(format string, a ...any) {
+	if l.debug {
+		fmt.Fprintf(l.errW, format, a...)
+	}
+}
+
+// SetDebug enables or disables debug messages.
+func (l *IOLogger) SetDebug(enabled bool) {
+	l.debug = enabled
+}
@@ -0,0 +1,279 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package manifest
+
+import (
+	"strconv"
+	"strings"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/literal"
+	"github.com/loft-orbital/cuebe/pkg/sensitive"
+)
+
+// Redact returns a copy of mfs, the manifests extracted from v,
+// where the values v holds at the sensitive paths are replaced by sensitive.Redacted.
+// Structures are kept, only their scalar values are redacted.
+// A manifest sensitive as a whole keeps its apiVersion, kind, name and namespace.
+// Sensitive values reaching other fields through references are redacted too:
+// every string of a manifest containing one is scrubbed, as in logs and errors.
+// The manifests of mfs are left untouched.
+func Redact(v cue.Value, mfs []Manifest, paths []cue.Path) []Manifest {
+	redacted := make([]Manifest, len(mfs))
+	index := make(map[Id]int, len(mfs))
+	for i, m := range mfs {
+		redacted[i] = m
+		index[m.Id()] = i
+	}
+
+	copied := make(map[int]bool)
+	for _, p := range paths {
+		for _, t := range targets(v, p) {
+			i, ok := index[t.id]
+			if !ok {
+				continue
+			}
+			if !copied[i] {
+				redacted[i] = New(mfs[i].DeepCopy())
+				copied[i] = true
+			}
+			if len(t.fields) == 0 {
+				redactManifest(redacted[i].Object)
+			} else {
+				redactField(redacted[i].Object, t.fields)
+			}
+		}
+	}
+
+	secrets := hidden(sensitive.ValuesAt(v, paths), redacted)
+	for i := range redacted {
+		if !copied[i] && !containsSecret(redacted[i].Object, secrets) {
+			continue
+		}
+		if !copied[i] {
+			redacted[i] = New(mfs[i].DeepCopy())
+			copied[i] = true
+		}
+		scrub(redacted[i].Object, secrets)
+	}
+	return redacted
+}
+
+// hidden returns the secrets that are not part of what identifies the manifests,
+// which stays visible anyway.
+func hidden(secrets []string, mfs []Manifest) []string {
+	visible := make(map[string]bool)
+	for _, m := range mfs {
+		for _, s := range []string{m.GetAPIVersion(), m.GetKind(), m.GetName(), m.GetNamespace()} {
+			visible[s] = true
+		}
+	}
+	var hidden []string
+	for _, s := range secrets {
+		if !visible[s] {
+			hidden = append(hidden, s)
+		}
+	}
+	return hidden
+}
+
+// containsSecret reports whether a string of obj contains one of secrets.
+func containsSecret(obj interface{}, secrets []string) bool {
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		for _, e := range o {
+			if containsSecret(e, secrets) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, e := range o {
+			if containsSecret(e, secrets) {
+				return true
+			}
+		}
+	case string:
+		for _, s := range secrets {
+			if strings.Contains(o, s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scrub replaces the secrets contained in the strings of obj by sensitive.Redacted,
+// except in the fields identifying a manifest.
+func scrub(obj map[string]interface{}, secrets []string) {
+	for k, v := range obj {
+		switch k {
+		case "apiVersion", "kind":
+		case "metadata":
+			meta, ok := v.(map[string]interface{})
+			if !ok {
+				obj[k] = scrubAll(v, secrets)
+				continue
+			}
+			for mk, mv := range meta {
+				if mk != "name" && mk != "namespace" {
+					meta[mk] = scrubAll(mv, secrets)
+				}
+			}
+		default:
+			obj[k] = scrubAll(v, secrets)
+		}
+	}
+}
+
+// scrubAll replaces the secrets contained in every string of v by sensitive.Redacted.
+func scrubAll(v interface{}, secrets []string) interface{} {
+	switch o := v.(type) {
+	case map[string]interface{}:
+		for k, e := range o {
+			o[k] = scrubAll(e, secrets)
+		}
+		return o
+	case []interface{}:
+		for i, e := range o {
+			o[i] = scrubAll(e, secrets)
+		}
+		return o
+	case string:
+		return sensitive.Redact(o, secrets)
+	default:
+		return v
+	}
+}
+
+// target is a sensitive field of a manifest.
+type target struct {
+	id Id
+	// fields leads to the sensitive field, the whole manifest if empty.
+	fields []cue.Selector
+}
+
+// targets returns the manifest fields the sensitive path p refers to:
+// a field of its enclosing manifest, or all the manifests it contains.
+func targets(v cue.Value, p cue.Path) []target {
+	sels := p.Selectors()
+	for n := len(sels); n >= 0; n-- {
+		mv := v.LookupPath(cue.MakePath(sels[:n]...))
+		if IsManifest(mv) {
+			m, err := Decode(mv)
+			if err != nil {
+				return nil
+			}
+			return []target{{id: m.Id(), fields: sels[n:]}}
+		}
+	}
+
+	var ts []target
+	v.LookupPath(p).Walk(func(v cue.Value) bool {
+		if !IsManifest(v) {
+			return true
+		}
+		if m, err := Decode(v); err == nil {
+			ts = append(ts, target{id: m.Id()})
+		}
+		return false
+	}, nil)
+	return ts
+}
+
+// redactManifest redacts a whole manifest object, except what identifies it.
+func redactManifest(obj map[string]interface{}) {
+	for k, v := range obj {
+		switch k {
+		case "apiVersion", "kind":
+		case "metadata":
+			meta, ok := v.(map[string]interface{})
+			if !ok {
+				obj[k] = redactAll(v)
+				continue
+			}
+			for mk, mv := range meta {
+				if mk != "name" && mk != "namespace" {
+					meta[mk] = redactAll(mv)
+				}
+			}
+		default:
+			obj[k] = redactAll(v)
+		}
+	}
+}
+
+// redactField redacts the field of obj the selectors lead to, if any.
+func redactField(obj interface{}, fields []cue.Selector) {
+	for len(fields) > 1 {
+		obj = child(obj, fields[0])
+		fields = fields[1:]
+	}
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		k := key(fields[0])
+		if v, ok := o[k]; ok {
+			o[k] = redactAll(v)
+		}
+	case []interface{}:
+		if i, err := strconv.Atoi(fields[0].String()); err == nil && i >= 0 && i < len(o) {
+			o[i] = redactAll(o[i])
+		}
+	}
+}
+
+// child returns the element of obj the selector s leads to, nil if none.
+func child(obj interface{}, s cue.Selector) interface{} {
+	switch o := obj.(type) {
+	case map[string]interface{}:
+		return o[key(s)]
+	case []interface{}:
+		if i, err := strconv.Atoi(s.String()); err == nil && i >= 0 && i < len(o) {
+			return o[i]
+		}
+	}
+	return nil
+}
+
+// redactAll replaces every scalar of v by sensitive.Redacted.
+func redactAll(v interface{}) interface{} {
+	switch o := v.(type) {
+	case map[string]interface{}:
+		for k, e := range o {
+			o[k] = redactAll(e)
+		}
+		return o
+	case []interface{}:
+		for i, e := range o {
+			o[i] = redactAll(e)
+		}
+		return o
+	case nil:
+		return nil
+	default:
+		return sensitive.Redacted
+	}
+}
+
+// key returns the unquoted field name of s.
+func key(s cue.Selector) string {
+	k := s.String()
+	if strings.HasPrefix(k, `"`) {
+		if u, err := literal.Unquote(k); err == nil {
+			return u
+		}
+	}
+	return k
+}
@@ -0,0 +1,118 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package manifest
+
+import (
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedact(t *testing.T) {
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`
+secret: {
+	apiVersion: "v1"
+	kind:       "Secret"
+	metadata: name: "creds"
+	data: {
+		"password.txt": "hunter2"
+		user:           "admin"
+	}
+}
+deployment: {
+	apiVersion: "apps/v1"
+	kind:       "Deployment"
+	metadata: name: "app"
+	spec: containers: [{
+		name: "app"
+		env: [{name: "TOKEN", value: "s3cr3t"}]
+	}]
+}
+whole: {
+	apiVersion: "v1"
+	kind:       "Secret"
+	metadata: {
+		name:      "whole"
+		namespace: "ns"
+		labels: app: "app"
+	}
+	data: key: "value"
+}
+`)
+	mfs, err := Extract(v, cue.ParsePath("deployment"), cue.ParsePath("secret"), cue.ParsePath("whole"))
+	require.NoError(t, err)
+	sort.Slice(mfs, func(i, j int) bool { return mfs[i].GetName() < mfs[j].GetName() })
+
+	redacted := Redact(v, mfs, []cue.Path{
+		cue.ParsePath(`secret.data."password.txt"`),
+		cue.ParsePath("deployment.spec.containers[0].env"),
+		cue.ParsePath("whole"),
+		cue.ParsePath("unknown.path"),
+	})
+
+	expected := []string{
+		`{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "app"},
+			"spec": {"containers": [{"name": "app", "env": [{"name": "<redacted>", "value": "<redacted>"}]}]}}`,
+		`{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "creds"},
+			"data": {"password.txt": "<redacted>", "user": "admin"}}`,
+		`{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "whole", "namespace": "ns", "labels": {"app": "<redacted>"}},
+			"data": {"key": "<redacted>"}}`,
+	}
+	require.Len(t, redacted, len(expected))
+	for i, e := range expected {
+		b, err := json.Marshal(redacted[i].Object)
+		require.NoError(t, err)
+		assert.JSONEq(t, e, string(b))
+	}
+
+	// originals are untouched
+	assert.Equal(t, "hunter2", mfs[1].Object["data"].(map[string]interface{})["password.txt"])
+}
+
+func TestRedactReference(t *testing.T) {
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`
+secrets: token: "s3cr3t"
+config: {
+	apiVersion: "v1"
+	kind:       "ConfigMap"
+	metadata: name: "app"
+	data: {
+		token:  secrets.token
+		header: "Bearer \(secrets.token)"
+		user:   "admin"
+	}
+}
+`)
+	mfs, err := Extract(v, cue.ParsePath("config"))
+	require.NoError(t, err)
+
+	redacted := Redact(v, mfs, []cue.Path{cue.ParsePath("secrets.token")})
+	require.Len(t, redacted, 1)
+	b, err := json.Marshal(redacted[0].Object)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "app"},
+		"data": {"token": "<redacted>", "header": "Bearer <redacted>", "user": "admin"}}`, string(b))
+
+	// originals are untouched
+	assert.Equal(t, "s3cr3t", mfs[0].Object["data"].(map[string]interface{})["token"])
+}
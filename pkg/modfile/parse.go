@@ -24,7 +24,17 @@ import (
 
 // Parse parses a CUE modfile (often located in cue.mod/module.cue).
 func Parse(file string) (*File, error) {
-	cf, err := parser.ParseFile(file, nil)
+	return parse(file, nil)
+}
+
+// ParseBytes parses a CUE modfile from its content.
+// file is only used in error messages.
+func ParseBytes(file string, src []byte) (*File, error) {
+	return parse(file, src)
+}
+
+func parse(file string, src interface{}) (*File, error) {
+	cf, err := parser.ParseFile(file, src)
 	if err != nil {
 		return nil, fmt.Errorf("could not parse modfile: %w", err)
 	}
@@ -91,3 +91,12 @@ module: "potato"
 	_, err = Parse(filename)
 	assert.Error(t, err)
 }
+
+func TestParseBytes(t *testing.T) {
+	mf, err := ParseBytes(CueModFile, []byte(`module: "host.com/potato/fries"`))
+	assert.NoError(t, err)
+	assert.Equal(t, "host.com/potato/fries", mf.Module)
+
+	_, err = ParseBytes(CueModFile, []byte("module: 2"))
+	assert.Error(t, err)
+}
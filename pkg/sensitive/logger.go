@@ -0,0 +1,46 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sensitive
+
+import (
+	"fmt"
+
+	"github.com/loft-orbital/cuebe/pkg/log"
+)
+
+// Logger is a log.Logger hiding secrets from the messages of the Logger it wraps.
+type Logger struct {
+	logger  log.Logger
+	secrets []string
+}
+
+// NewLogger returns a Logger redacting secrets from the messages sent to l.
+func NewLogger(l log.Logger, secrets []string) *Logger {
+	return &Logger{logger: l, secrets: secrets}
+}
+
+func (l *Logger) Info(format string, v ...interface{}) {
+	l.logger.Info("%s", Redact(fmt.Sprintf(format, v...), l.secrets))
+}
+
+func (l *Logger) Error(format string, v ...interface{}) {
+	l.logger.Error("%s", Redact(fmt.Sprintf(format, v...), l.secrets))
+}
+
+// Debug forwards debug messages to the wrapped Logger, if it is a log.DebugLogger.
+func (l *Logger) Debug(format string, v ...interface{}) {
+	log.Debug(l.logger, "%s", Redact(fmt.Sprintf(format, v...), l.secrets))
+}
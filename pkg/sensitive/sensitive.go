@@ -0,0 +1,139 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sensitive
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"cuelang.org/go/cue"
+)
+
+// Redacted replaces sensitive values.
+const Redacted = "<redacted>"
+
+// Paths is a set of CUE paths holding sensitive values,
+// i.e. values coming from encrypted sources or explicitly marked as sensitive.
+// It is safe for concurrent use. A nil *Paths ignores additions.
+type Paths struct {
+	mu    sync.RWMutex
+	paths map[string]cue.Path
+}
+
+// NewPaths returns an empty set of paths.
+func NewPaths() *Paths {
+	return &Paths{paths: make(map[string]cue.Path)}
+}
+
+// Add marks the values at paths, and everything they contain, as sensitive.
+func (p *Paths) Add(paths ...cue.Path) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, path := range paths {
+		p.paths[path.String()] = path
+	}
+}
+
+// List returns the sensitive paths, sorted.
+func (p *Paths) List() []cue.Path {
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	keys := make([]string, 0, len(p.paths))
+	for k := range p.paths {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	paths := make([]cue.Path, len(keys))
+	for i, k := range keys {
+		paths[i] = p.paths[k]
+	}
+	return paths
+}
+
+// Contains reports whether the value at path is sensitive,
+// i.e. path or one of its parents was added.
+func (p *Paths) Contains(path cue.Path) bool {
+	for _, s := range p.List() {
+		if HasPrefix(path, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Values returns the concrete strings and bytes v holds at the sensitive paths.
+// They are the secrets to hide from free-form text such as logs and error messages.
+func (p *Paths) Values(v cue.Value) []string {
+	return ValuesAt(v, p.List())
+}
+
+// ValuesAt returns the concrete strings and bytes v holds at paths, longest first.
+func ValuesAt(v cue.Value, paths []cue.Path) []string {
+	seen := make(map[string]bool)
+	var values []string
+	for _, path := range paths {
+		v.LookupPath(path).Walk(nil, func(v cue.Value) {
+			var s string
+			switch v.Kind() {
+			case cue.StringKind:
+				s, _ = v.String()
+			case cue.BytesKind:
+				b, _ := v.Bytes()
+				s = string(b)
+			}
+			if s != "" && !seen[s] {
+				seen[s] = true
+				values = append(values, s)
+			}
+		})
+	}
+	// longest first, so that a secret containing another one is replaced as a whole
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	return values
+}
+
+// Redact replaces every secret in s by Redacted.
+func Redact(s string, secrets []string) string {
+	if len(secrets) == 0 {
+		return s
+	}
+	oldnew := make([]string, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		oldnew = append(oldnew, secret, Redacted)
+	}
+	return strings.NewReplacer(oldnew...).Replace(s)
+}
+
+// HasPrefix reports whether path starts with prefix.
+func HasPrefix(path, prefix cue.Path) bool {
+	ps, pfx := path.Selectors(), prefix.Selectors()
+	if len(pfx) > len(ps) {
+		return false
+	}
+	for i, s := range pfx {
+		if s.String() != ps[i].String() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+/*
+Copyright © 2021 Loft Orbital
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sensitive
+
+import (
+	"bytes"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/loft-orbital/cuebe/pkg/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaths(t *testing.T) {
+	var nilPaths *Paths
+	nilPaths.Add(cue.ParsePath("a"))
+	assert.Empty(t, nilPaths.List())
+
+	p := NewPaths()
+	p.Add(cue.ParsePath("b.c"), cue.ParsePath("a"), cue.ParsePath("a"))
+	assert.Equal(t, []cue.Path{cue.ParsePath("a"), cue.ParsePath("b.c")}, p.List())
+
+	assert.True(t, p.Contains(cue.ParsePath("a")))
+	assert.True(t, p.Contains(cue.ParsePath("a.b")))
+	assert.True(t, p.Contains(cue.ParsePath("b.c[0]")))
+	assert.False(t, p.Contains(cue.ParsePath("b")))
+	assert.False(t, p.Contains(cue.ParsePath("ab")))
+}
+
+func TestValues(t *testing.T) {
+	ctx := cuecontext.New()
+	v := ctx.CompileString(`
+a: {token: "s3cr3t", port: 5432, nested: ["pass", "password"]}
+b: 'bytes'
+c: "plain"
+d: ""
+`)
+	p := NewPaths()
+	p.Add(cue.ParsePath("a"), cue.ParsePath("b"), cue.ParsePath("d"), cue.ParsePath("missing"))
+	assert.Equal(t, []string{"password", "s3cr3t", "bytes", "pass"}, p.Values(v))
+}
+
+func TestRedact(t *testing.T) {
+	secrets := []string{"password", "pass"}
+	assert.Equal(t, "<redacted> and <redacted>", Redact("password and pass", secrets))
+	assert.Equal(t, "nothing", Redact("nothing", nil))
+}
+
+func TestLogger(t *testing.T) {
+	out, err := new(bytes.Buffer), new(bytes.Buffer)
+	l := NewLogger(log.NewIOLogger(out, err), []string{"s3cr3t"})
+
+	l.Info("token is %s\n", "s3cr3t")
+	l.Error("%d%%: s3cr3t\n", 100)
+	assert.Equal(t, "token is <redacted>\n", out.String())
+	assert.Equal(t, "100%: <redacted>\n", err.String())
+}
@@ -37,10 +37,8 @@ func ReadFile(filename string, fsys fs.FS) ([]byte, error) {
 		return nil, fmt.Errorf("could not read file: %w", err)
 	}
 
-	// encrypted file
-	ext := path.Ext(filename)
-	if strings.HasSuffix(filename, ".enc"+ext) {
-		data, err = decrypt.Data(data, ext[1:])
+	if IsEncrypted(filename) {
+		data, err = decrypt.Data(data, path.Ext(filename)[1:])
 		if err != nil {
 			return nil, fmt.Errorf("could not decrypt data: %w", err)
 		}
@@ -48,3 +46,9 @@ func ReadFile(filename string, fsys fs.FS) ([]byte, error) {
 
 	return data, nil
 }
+
+// IsEncrypted reports whether filename is a sops-encrypted file, i.e. ends by .enc.*.
+func IsEncrypted(filename string) bool {
+	ext := path.Ext(filename)
+	return ext != "" && strings.HasSuffix(filename, ".enc"+ext)
+}
@@ -56,3 +56,11 @@ func TestReadFile(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []byte("hello: 1"), b)
 }
+
+func TestIsEncrypted(t *testing.T) {
+	assert.True(t, IsEncrypted("secrets.enc.yaml"))
+	assert.True(t, IsEncrypted("dir/secrets.enc.json"))
+	assert.False(t, IsEncrypted("secrets.yaml"))
+	assert.False(t, IsEncrypted("secrets.enc"))
+	assert.False(t, IsEncrypted("enc.yaml"))
+}
@@ -34,12 +34,17 @@ type Unifier struct {
 	values []cue.Value
 }
 
+// New returns an empty Unifier.
+func New() *Unifier {
+	return &Unifier{
+		ctx: cuecontext.New(),
+	}
+}
+
 // Load loads instances inside entrypoints, using wd as a working directory.
 // It returns the Unifier containing all the values find.
 func Load(entrypoints []string, cfg *load.Config) (*Unifier, error) {
-	u := &Unifier{
-		ctx: cuecontext.New(),
-	}
+	u := New()
 	bis := load.Instances(entrypoints, cfg)
 	var err error
 	u.values, err = u.ctx.BuildInstances(bis)
@@ -69,23 +74,50 @@ func (u *Unifier) Unify() cue.Value {
 // AddFile parse and compile an orphan file, then add it to the Unifier's values.
 // It plain texti (cue,yaml,json) or sops-encrypted files.
 func (u *Unifier) AddFile(file string, fsys fs.FS) error {
+	v, err := u.ParseFile(file, fsys)
+	if err != nil {
+		return err
+	}
+	u.Add(v)
+	return nil
+}
+
+// ParseFile parse and compile an orphan file, plain text (cue, yaml, json) or sops-encrypted,
+// without adding it to the Unifier's values.
+func (u *Unifier) ParseFile(file string, fsys fs.FS) (cue.Value, error) {
 	um, err := UnmarshallerFor(path.Ext(file))
 	if err != nil {
-		return fmt.Errorf("failed to add %s: %w", file, err)
+		return cue.Value{}, fmt.Errorf("failed to add %s: %w", file, err)
 	}
 
 	b, err := ReadFile(file, fsys)
 	if err != nil {
-		return fmt.Errorf("failed to add %s: %w", file, err)
+		return cue.Value{}, fmt.Errorf("failed to add %s: %w", file, err)
 	}
+	return u.parse(file, b, um)
+}
 
+// Parse compiles b, the content of an orphan file, plain text (cue, yaml, json) or already decrypted,
+// without adding it to the Unifier's values.
+func (u *Unifier) Parse(file string, b []byte) (cue.Value, error) {
+	um, err := UnmarshallerFor(path.Ext(file))
+	if err != nil {
+		return cue.Value{}, fmt.Errorf("failed to add %s: %w", file, err)
+	}
+	return u.parse(file, b, um)
+}
+
+func (u *Unifier) parse(file string, b []byte, um Unmarshaller) (cue.Value, error) {
 	v, err := um.Unmarshal(b, u.ctx, cue.Filename(file))
 	if err != nil {
-		return fmt.Errorf("failed to add %s: %w", file, err)
+		return cue.Value{}, fmt.Errorf("failed to add %s: %w", file, err)
 	}
+	return v, nil
+}
 
+// Add adds v, a value of the Unifier's context, to the Unifier's values.
+func (u *Unifier) Add(v cue.Value) {
 	u.vLock.Lock()
 	defer u.vLock.Unlock()
 	u.values = append(u.values, v)
-	return nil
 }